@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	buildCommand = &cli.Command{
+		Name:  "build",
+		Usage: "Build the fuzz targets listed in a config file",
+		Description: `Build builds all fuzz targets listed in the config file, or only the ones given
+by name. The config file is in TOML, for example:
+
+  # Settings at the top apply to all targets, unless overridden.
+  out = "build"
+  tags = ["gofuzz_libfuzzer"]
+  link = true
+
+  [[target]]
+  name = "fuzz_rlp"
+  package = "github.com/ethereum/go-ethereum/rlp"
+  func = "FuzzDecode"
+  fiximports = ["rlp/decode_test.go"]
+  dict = true
+
+Each target supports the keys name, package, func, fiximports, legacy, init,
+min_lens, and the settings out, tags, build_args, engine, link, link_cc,
+sanitizers, link_libs and dict. Paths are relative to the working directory.
+
+With --keep-sources, the sources of each target are kept in a subdirectory
+named after the target.`,
+		ArgsUsage: "[<target-name>...]",
+		Flags: []cli.Flag{
+			configFlag,
+			dryRunFlag,
+			keepSourcesFlag,
+		},
+		Action: buildTargets,
+	}
+
+	configFlag = &cli.PathFlag{
+		Name:  "config",
+		Usage: "The config file",
+		Value: "gofuzz-shim.toml",
+	}
+)
+
+// targetConfig is the configuration of a fuzz target in the config file.
+type targetConfig struct {
+	Name       string   `toml:"name"`       // name of the output
+	Package    string   `toml:"package"`    // import path of the target package
+	Func       string   `toml:"func"`       // name of the fuzz target
+	FixImports []string `toml:"fiximports"` // files to rewrite the imports of
+	Legacy     bool     `toml:"legacy"`     // the target is a go-fuzz style target
+	Init       string   `toml:"init"`       // function to call on initialization
+	MinLens    []int    `toml:"min_lens"`   // minimum lengths of the dynamic-sized arguments
+
+	Out        string   `toml:"out"`        // output directory
+	Tags       []string `toml:"tags"`       // build tags
+	BuildArgs  []string `toml:"build_args"` // extra arguments for go build
+	Engine     string   `toml:"engine"`     // fuzzing engine
+	Link       bool     `toml:"link"`       // link an executable
+	LinkCC     string   `toml:"link_cc"`    // compiler used for linking
+	Sanitizers []string `toml:"sanitizers"` // sanitizers to link with
+	LinkLibs   []string `toml:"link_libs"`  // runtime libraries of the engine
+	Dict       bool     `toml:"dict"`       // write a dictionary
+}
+
+// configFile is the layout of the config file: the settings at the top are
+// the defaults for the targets.
+type configFile struct {
+	targetConfig
+	Targets []toml.Primitive `toml:"target"`
+}
+
+// loadConfig reads the targets from a config file. Settings before the first
+// [[target]] table are the defaults for all targets.
+func loadConfig(r io.Reader) ([]*targetConfig, error) {
+	file := configFile{
+		targetConfig: targetConfig{
+			Func:   fuzzFlag.Value,
+			Out:    ".",
+			Tags:   tagsFlag.Value.Value(),
+			Engine: engineFlag.Value,
+		},
+	}
+	md, err := toml.NewDecoder(r).Decode(&file)
+	if err != nil {
+		return nil, err
+	}
+	var targets []*targetConfig
+	for _, prim := range file.Targets {
+		target := file.targetConfig
+		if err := md.PrimitiveDecode(prim, &target); err != nil {
+			return nil, fmt.Errorf("target %d: %w", len(targets)+1, err)
+		}
+		targets = append(targets, &target)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown key %q", undecoded[0].String())
+	}
+	names := make(map[string]bool)
+	for i, t := range targets {
+		if t.Name == "" || t.Package == "" {
+			return nil, fmt.Errorf("target %d: name and package are required", i+1)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("duplicate target %q", t.Name)
+		}
+		names[t.Name] = true
+	}
+	return targets, nil
+}
+
+func buildTargets(ctx *cli.Context) error {
+	f, err := os.Open(ctx.Path(configFlag.Name))
+	if err != nil {
+		return err
+	}
+	targets, err := loadConfig(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%v: %w", ctx.Path(configFlag.Name), err)
+	}
+	if names := ctx.Args().Slice(); len(names) > 0 {
+		var selected []*targetConfig
+		for _, name := range names {
+			i := slices.IndexFunc(targets, func(t *targetConfig) bool { return t.Name == name })
+			if i < 0 {
+				return fmt.Errorf("unknown target %q", name)
+			}
+			selected = append(selected, targets[i])
+		}
+		targets = selected
+	}
+	var (
+		dryRun = ctx.Bool(dryRunFlag.Name)
+		keep   = ctx.Path(keepSourcesFlag.Name)
+	)
+	for _, t := range targets {
+		var keepDir string
+		if keep != "" {
+			keepDir = filepath.Join(keep, t.Name)
+		}
+		if err := buildTarget(t, dryRun, keepDir); err != nil {
+			return fmt.Errorf("%v: %w", t.Name, err)
+		}
+	}
+	if dryRun {
+		slog.Info("Dry run, not building fuzz targets", "count", len(targets))
+		return nil
+	}
+	slog.Info("Built fuzz targets", "count", len(targets))
+	return nil
+}
+
+// buildTarget builds the fuzz target described by t. If dryRun is set, the
+// sources are generated but not built, see buildConfig.
+func buildTarget(t *targetConfig, dryRun bool, keepSources string) error {
+	eng, err := engineByName(t.Engine)
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		if err := os.MkdirAll(t.Out, 0755); err != nil {
+			return err
+		}
+	}
+	cfg := &buildConfig{
+		pkg:       t.Package,
+		files:     t.FixImports,
+		fuzzFunc:  t.Func,
+		output:    filepath.Join(t.Out, t.Name+".a"),
+		exe:       filepath.Join(t.Out, t.Name),
+		buildArgs: t.BuildArgs,
+		tags:      t.Tags,
+		legacy:    t.Legacy,
+		initFunc:  t.Init,
+		minLens:   t.MinLens,
+		engine:    eng,
+
+		dryRun:      dryRun,
+		keepSources: keepSources,
+	}
+	if t.Link {
+		if cfg.linker, err = newLinker(linkCC(t.LinkCC, eng), eng, t.Sanitizers, t.LinkLibs); err != nil {
+			return err
+		}
+	}
+	if err := buildFuzzer(cfg); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	if cfg.linker == nil && eng.name != "libfuzzer" {
+		recipe := &linker{cc: eng.cc, engine: eng, sanitizers: t.Sanitizers, libs: t.LinkLibs}
+		slog.Info("Link the archive with the engine's compiler", "command", recipe.command(cfg.output, cfg.exe))
+	}
+	if t.Dict {
+		if err := writeDict(cfg, filepath.Join(t.Out, t.Name+".dict")); err != nil {
+			return err
+		}
+	}
+	if eng.setup != nil {
+		return eng.setup(cfg)
+	}
+	return nil
+}
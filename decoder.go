@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// consumers maps the argument types supported by generated decoders to the
+// input.Source method which decodes them.
+var consumers = map[string]string{
+	"int":        "ConsumeInt",
+	"int8":       "ConsumeInt8",
+	"int16":      "ConsumeInt16",
+	"int32":      "ConsumeInt32",
+	"rune":       "ConsumeInt32",
+	"int64":      "ConsumeInt64",
+	"uint":       "ConsumeUint",
+	"uint8":      "ConsumeUint8",
+	"byte":       "ConsumeUint8",
+	"uint16":     "ConsumeUint16",
+	"uint32":     "ConsumeUint32",
+	"uint64":     "ConsumeUint64",
+	"uintptr":    "ConsumeUintptr",
+	"float32":    "ConsumeFloat32",
+	"float64":    "ConsumeFloat64",
+	"complex64":  "ConsumeComplex64",
+	"complex128": "ConsumeComplex128",
+	"bool":       "ConsumeBool",
+	"string":     "ConsumeString",
+	"[]byte":     "ConsumeBytes",
+	"[]uint8":    "ConsumeBytes",
+}
+
+// isDynamic returns whether the given (supported) type is dynamic-sized.
+func isDynamic(typ string) bool {
+	return typ == "string" || strings.HasPrefix(typ, "[]")
+}
+
+// findFunc locates the top-level function fuzzFunc in the given files. It
+// returns nil if the function is not found.
+func findFunc(paths []string, fuzzFunc string) (*ast.FuncDecl, error) {
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		astFile, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range astFile.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && fn.Recv == nil && fn.Name.Name == fuzzFunc && fn.Body != nil {
+				return fn, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// fuzzArgs locates the fuzz target fuzzFunc in the given files, and returns
+// the argument types of the function passed to f.Fuzz, excluding the leading
+// *testing.T. It returns nil if the target or the f.Fuzz call is not found.
+func fuzzArgs(paths []string, fuzzFunc string) ([]string, error) {
+	fn, err := findFunc(paths, fuzzFunc)
+	if fn == nil || err != nil {
+		return nil, err
+	}
+	var lit *ast.FuncLit
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || lit != nil || len(call.Args) != 1 {
+			return lit == nil
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Fuzz" {
+			lit, _ = call.Args[0].(*ast.FuncLit)
+		}
+		return lit == nil
+	})
+	if lit == nil {
+		return nil, nil
+	}
+	args := paramTypes(lit.Type)
+	if len(args) == 0 {
+		return nil, nil
+	}
+	return args[1:], nil
+}
+
+// isLegacy reports whether fuzzFunc, in the given files, is a go-fuzz style
+// target: func Fuzz(data []byte) int.
+func isLegacy(paths []string, fuzzFunc string) (bool, error) {
+	fn, err := findFunc(paths, fuzzFunc)
+	if fn == nil || err != nil {
+		return false, err
+	}
+	params := strings.Join(paramTypes(fn.Type), ",")
+	if params != "[]byte" && params != "[]uint8" {
+		return false, nil
+	}
+	results := fn.Type.Results
+	return results != nil && len(results.List) == 1 && len(results.List[0].Names) <= 1 &&
+		types.ExprString(results.List[0].Type) == "int", nil
+}
+
+// paramTypes returns the parameter types of a function type, one per parameter.
+func paramTypes(typ *ast.FuncType) []string {
+	var args []string
+	for _, field := range typ.Params.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			args = append(args, types.ExprString(field.Type))
+		}
+	}
+	return args
+}
+
+// genDecoder generates a typed decoder for a fuzz target taking the given
+// arguments (after the *testing.T), with the same input layout as
+// input.Source.FillAndCall. It returns an empty string if any of the argument
+// types is not supported.
+func genDecoder(fuzzFunc string, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	var fixed, dynamic []int
+	for i, typ := range args {
+		if _, ok := consumers[typ]; !ok {
+			return "", nil
+		}
+		if isDynamic(typ) {
+			dynamic = append(dynamic, i)
+		} else {
+			fixed = append(fixed, i)
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// decode%v decodes the arguments for %v without reflection,\n", fuzzFunc, fuzzFunc)
+	fmt.Fprintf(&b, "// using the same input layout as input.Source.FillAndCall.\n")
+	fmt.Fprintf(&b, "func decode%v(src *input.Source, t *testing.T, ff any) bool {\n", fuzzFunc)
+	fmt.Fprintf(&b, "fn, ok := ff.(func(*testing.T, %v))\n", strings.Join(args, ", "))
+	fmt.Fprintf(&b, "if !ok {\nreturn false\n}\n")
+	for _, i := range fixed {
+		fmt.Fprintf(&b, "arg%d := src.%v()\n", i, consumers[args[i]])
+	}
+	if len(dynamic) > 0 {
+		// All supported dynamic-sized types have an element size of 1
+		sizes := strings.TrimSuffix(strings.Repeat("1, ", len(dynamic)), ", ")
+		fmt.Fprintf(&b, "split := src.Split(%v)\n", sizes)
+		for _, i := range dynamic {
+			fmt.Fprintf(&b, "arg%d := src.%v(split.Next())\n", i, consumers[args[i]])
+		}
+	}
+	var names []string
+	for i := range args {
+		names = append(names, fmt.Sprintf("arg%d", i))
+	}
+	fmt.Fprintf(&b, "src.Invoke(func() { fn(t, %v) })\n", strings.Join(names, ", "))
+	fmt.Fprintf(&b, "return true\n}\n")
+	out, err := format.Source(b.Bytes())
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/holiman/gofuzz-shim/input"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slog"
+)
+
+var dictFlag = &cli.PathFlag{
+	Name:  "dict",
+	Usage: "Write a libFuzzer dictionary, with the literals the target package (and its dependencies) compare against, to this file",
+}
+
+// maxTokenLen is the maximum length of a dictionary entry used by libFuzzer.
+const maxTokenLen = 64
+
+// tokenFuncs are the functions of the bytes and strings packages whose
+// (literal) arguments are collected as tokens.
+var tokenFuncs = map[string]bool{
+	"HasPrefix": true, "HasSuffix": true, "TrimPrefix": true, "TrimSuffix": true,
+	"CutPrefix": true, "CutSuffix": true, "Cut": true, "Contains": true,
+	"Equal": true, "EqualFold": true, "Compare": true, "Index": true,
+	"LastIndex": true, "Count": true, "Split": true, "SplitN": true,
+}
+
+// extractTokens collects the string and byte constants, and the integer
+// constants, which the code in the given type-checked files compares against:
+// operands of comparisons, switch cases, and arguments to the
+// prefix/suffix/containment functions of the bytes and strings packages.
+// Besides literals, this includes named constants and constant expressions.
+func extractTokens(files []*ast.File, info *types.Info, tokens map[string]bool) {
+	add := func(expr ast.Expr) {
+		for _, tok := range constTokens(expr, info) {
+			if len(tok) > 0 && len(tok) <= maxTokenLen {
+				tokens[tok] = true
+			}
+		}
+	}
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BinaryExpr:
+				switch n.Op {
+				case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+					add(n.X)
+					add(n.Y)
+				}
+			case *ast.CaseClause:
+				for _, expr := range n.List {
+					add(expr)
+				}
+			case *ast.CallExpr:
+				sel, ok := n.Fun.(*ast.SelectorExpr)
+				if !ok || !tokenFuncs[sel.Sel.Name] {
+					break
+				}
+				if pkg, ok := sel.X.(*ast.Ident); ok && (pkg.Name == "bytes" || pkg.Name == "strings") {
+					for _, arg := range n.Args {
+						add(arg)
+					}
+				}
+			}
+			return true
+		})
+	}
+}
+
+// constTokens returns the tokens for a constant expression: the value of a
+// string constant (possibly converted to []byte), or the big- and
+// little-endian encodings of an integer constant. Small integers are skipped,
+// since the fuzzer finds those easily.
+func constTokens(expr ast.Expr, info *types.Info) []string {
+	if call, ok := unparen(expr).(*ast.CallExpr); ok && len(call.Args) == 1 {
+		if arr, ok := call.Fun.(*ast.ArrayType); ok && arr.Len == nil {
+			expr = call.Args[0]
+		}
+	}
+	tv, ok := info.Types[expr]
+	if !ok || tv.Value == nil {
+		return nil
+	}
+	switch tv.Value.Kind() {
+	case constant.String:
+		return []string{constant.StringVal(tv.Value)}
+	case constant.Int:
+		v, ok := constant.Uint64Val(tv.Value)
+		if !ok || v < 256 {
+			return nil
+		}
+		size := 8
+		if v <= 0xffff {
+			size = 2
+		} else if v <= 0xffffffff {
+			size = 4
+		}
+		be := binary.BigEndian.AppendUint64(nil, v)[8-size:]
+		le := binary.LittleEndian.AppendUint64(nil, v)[:size]
+		return []string{string(be), string(le)}
+	}
+	return nil
+}
+
+// packageTokens extracts the tokens from the package pkg, including its
+// (internal and external) test files, and its non-standard dependencies. The
+// packages are type-checked, to resolve named constants.
+func packageTokens(pkg string, tags []string) ([]string, error) {
+	pkgs, err := listPackages([]string{pkg}, tags, true)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		imp = &tokenImporter{
+			fset:   token.NewFileSet(),
+			std:    importer.Default(),
+			pkgs:   make(map[string]*goPackage),
+			done:   make(map[string]*types.Package),
+			tokens: make(map[string]bool),
+		}
+		target *goPackage
+	)
+	for _, p := range pkgs {
+		if p.Standard {
+			continue
+		}
+		imp.pkgs[p.ImportPath] = p
+		if p.ImportPath == pkg {
+			target = p
+		}
+	}
+	for _, p := range pkgs {
+		if !p.Standard && p != target {
+			imp.Import(p.ImportPath)
+		}
+	}
+	if target != nil {
+		// The external tests import the package including its internal tests
+		files := append(slices.Clip(target.GoFiles), target.TestGoFiles...)
+		imp.done[target.ImportPath] = imp.check(target.ImportPath, target.Dir, files)
+		if len(target.XTestGoFiles) > 0 {
+			imp.check(target.ImportPath+"_test", target.Dir, target.XTestGoFiles)
+		}
+	}
+	out := maps.Keys(imp.tokens)
+	slices.Sort(out)
+	return out, nil
+}
+
+// tokenImporter type-checks the non-standard packages from source, and
+// extracts their tokens. Standard packages are imported from export data.
+type tokenImporter struct {
+	fset   *token.FileSet
+	std    types.Importer
+	pkgs   map[string]*goPackage // the non-standard packages, by import path
+	done   map[string]*types.Package
+	tokens map[string]bool
+}
+
+func (imp *tokenImporter) Import(path string) (*types.Package, error) {
+	if pkg, ok := imp.done[path]; ok {
+		return pkg, nil
+	}
+	p, ok := imp.pkgs[path]
+	if !ok {
+		return imp.std.Import(path)
+	}
+	imp.done[path] = nil // break import cycles
+	pkg := imp.check(path, p.Dir, p.GoFiles)
+	imp.done[path] = pkg
+	return pkg, nil
+}
+
+// check type-checks the given files of a package, and adds their tokens.
+// Type errors are ignored: constants which can't be resolved are skipped.
+func (imp *tokenImporter) check(path, dir string, names []string) *types.Package {
+	var files []*ast.File
+	for _, name := range names {
+		file, err := parser.ParseFile(imp.fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			slog.Warn("Failed to parse file for the dictionary", "file", name, "err", err)
+			continue
+		}
+		files = append(files, file)
+	}
+	var (
+		conf = types.Config{Importer: imp, Error: func(error) {}}
+		info = &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	)
+	pkg, _ := conf.Check(path, imp.fset, files, info)
+	extractTokens(files, info, imp.tokens)
+	return pkg
+}
+
+// stringModeForTags returns the decoding mode of plain string arguments, for
+// a build with the given tags.
+func stringModeForTags(tags []string) input.StringMode {
+	switch {
+	case slices.Contains(tags, "gofuzz_strings_utf8"):
+		return input.StringUTF8
+	case slices.Contains(tags, "gofuzz_strings_printable"):
+		return input.StringPrintable
+	}
+	return input.StringRaw
+}
+
+// padPolicyForTags returns the padding policy for exhausted inputs, for a build
+// with the given tags.
+func padPolicyForTags(tags []string) input.PadPolicy {
+	switch {
+	case slices.Contains(tags, "gofuzz_pad_skip"):
+		return input.PadSkip
+	case slices.Contains(tags, "gofuzz_pad_wrap"):
+		return input.PadWrap
+	}
+	return input.PadZero
+}
+
+// encodeTokens encodes the tokens in the input layout of a fuzz target with
+// the given arguments. Only strings decoded in StringPrintable mode need to be
+// encoded, other arguments use the token bytes as-is. If the target has both
+// kinds of arguments, both variants are included.
+func encodeTokens(tokens, args []string, tags []string) []string {
+	var raw, printable bool
+	for _, arg := range args {
+		switch {
+		case arg == "input.PrintableString":
+			printable = true
+		case arg == "string" && stringModeForTags(tags) == input.StringPrintable:
+			printable = true
+		default:
+			raw = true
+		}
+	}
+	if !printable {
+		return tokens
+	}
+	var out []string
+	for _, tok := range tokens {
+		if raw {
+			out = append(out, tok)
+		}
+		if enc, ok := input.EncodeString(tok, input.StringPrintable); ok {
+			out = append(out, string(enc))
+		}
+	}
+	return out
+}
+
+// formatDict formats the tokens as a libFuzzer (or AFL) dictionary.
+func formatDict(tokens []string) string {
+	var b strings.Builder
+	for _, tok := range tokens {
+		b.WriteByte('"')
+		for i := 0; i < len(tok); i++ {
+			switch c := tok[i]; {
+			case c == '"' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c >= ' ' && c <= '~':
+				b.WriteByte(c)
+			default:
+				fmt.Fprintf(&b, "\\x%02x", c)
+			}
+		}
+		b.WriteString("\"\n")
+	}
+	return b.String()
+}
+
+// fuzzerTokens extracts the tokens for the fuzz target in cfg, encoded for its
+// arguments.
+func fuzzerTokens(cfg *buildConfig) ([]string, error) {
+	tokens, err := packageTokens(cfg.pkg, cfg.tags)
+	if err != nil {
+		return nil, err
+	}
+	args, _ := fuzzArgs(cfg.files, cfg.fuzzFunc)
+	return encodeTokens(tokens, args, cfg.tags), nil
+}
+
+// writeDict extracts the tokens for the fuzz target in cfg, and writes them as
+// a dictionary to path.
+func writeDict(cfg *buildConfig, path string) error {
+	tokens, err := fuzzerTokens(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(formatDict(tokens)), 0644); err != nil {
+		return err
+	}
+	slog.Info("Wrote dictionary", "file", path, "tokens", len(tokens))
+	return nil
+}
+
+// writeTokenDir writes the tokens into dir, one per file, as AFL++ reads them
+// with -x. The tokens of earlier builds are removed.
+func writeTokenDir(dir string, tokens []string) error {
+	stale, _ := filepath.Glob(filepath.Join(dir, "token*"))
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	for i, tok := range tokens {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("token%04d", i)), []byte(tok), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slog"
+)
+
+// engine describes a fuzzing engine which the fuzzer can be built for. All
+// engines drive the fuzzer through LLVMFuzzerTestOneInput, after calling
+// LLVMFuzzerInitialize once, and consume the instrumentation of -d=libfuzzer.
+// They differ in how they are linked, and in what they make of the return
+// value.
+type engine struct {
+	name string
+	cc   string // the default compiler used for linking
+
+	// sanitizeFuzzer is set if the engine's runtime is linked in via
+	// -fsanitize=fuzzer, runtime names the library to link in otherwise (if
+	// the compiler does not do so already).
+	sanitizeFuzzer bool
+	runtime        string
+
+	// template names the template in template.txt defining the entry points
+	// for the engine: 'reject' for engines which support rejecting inputs,
+	// by returning -1 (rejected inputs are not added to the corpus), and
+	// 'ignore' for engines which ignore the return value.
+	template string
+
+	// setup, if set, creates engine-specific files for the fuzzer of cfg,
+	// after building.
+	setup func(cfg *buildConfig) error
+}
+
+var engines = map[string]*engine{
+	"libfuzzer": {
+		name:           "libfuzzer",
+		cc:             "clang++",
+		sanitizeFuzzer: true,
+		template:       "reject",
+	},
+	// AFL++ runs the LLVMFuzzerTestOneInput entry point through its libFuzzer
+	// driver, which afl-clang-fast links when given -fsanitize=fuzzer.
+	"aflpp": {
+		name:           "aflpp",
+		cc:             "afl-clang-fast++",
+		sanitizeFuzzer: true,
+		template:       "ignore",
+		setup:          setupAFL,
+	},
+	// hfuzz-clang links libhfuzz, which provides a main calling
+	// LLVMFuzzerTestOneInput, and picks up the inline 8-bit counters emitted
+	// by the go compiler.
+	"honggfuzz": {
+		name:     "honggfuzz",
+		cc:       "hfuzz-clang++",
+		template: "ignore",
+	},
+	// The Centipede runner provides a main calling LLVMFuzzerTestOneInput,
+	// and has to be linked in as a whole.
+	"centipede": {
+		name:     "centipede",
+		cc:       "clang++",
+		runtime:  "libcentipede_runner.a",
+		template: "reject",
+	},
+}
+
+var engineFlag = &cli.StringFlag{
+	Name:  "engine",
+	Usage: fmt.Sprintf("The fuzzing engine to build for, one of: %v", strings.Join(engineNames(), ", ")),
+	Value: "libfuzzer",
+}
+
+func engineNames() []string {
+	names := maps.Keys(engines)
+	slices.Sort(names)
+	return names
+}
+
+// engineByName returns the engine with the given name.
+func engineByName(name string) (*engine, error) {
+	e, ok := engines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown engine %q, want one of: %v", name, strings.Join(engineNames(), ", "))
+	}
+	return e, nil
+}
+
+// aflDir returns the directory holding the AFL++ files for the executable exe.
+func aflDir(exe string) string {
+	return exe + "_afl"
+}
+
+// setupAFL creates the directory layout used by afl-fuzz next to the
+// executable: an 'in' directory with seeds, and a 'dict' directory with
+// dictionary tokens, one per file. The seeds are those of the fuzz target (see
+// encodeSeeds), added to any already present. AFL++ refuses to start without
+// seeds, so an empty seed directory gets a single seed.
+func setupAFL(cfg *buildConfig) error {
+	var (
+		dir  = aflDir(cfg.exe)
+		in   = filepath.Join(dir, "in")
+		dict = filepath.Join(dir, "dict")
+	)
+	for _, d := range []string{in, dict} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+	seeds, err := targetSeeds(cfg)
+	if err != nil {
+		return err
+	}
+	for _, data := range seeds {
+		if err := os.WriteFile(filepath.Join(in, seedName(data)), data, 0644); err != nil {
+			return err
+		}
+	}
+	entries, err := os.ReadDir(in)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		if err := os.WriteFile(filepath.Join(in, "seed"), []byte{0}, 0644); err != nil {
+			return err
+		}
+	}
+	tokens, err := fuzzerTokens(cfg)
+	if err != nil {
+		return err
+	}
+	if err := writeTokenDir(dict, tokens); err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("afl-fuzz -i %v -o %v", in, filepath.Join(dir, "out"))
+	if len(tokens) > 0 {
+		cmd += " -x " + dict
+	}
+	slog.Info("Created AFL++ layout", "dir", dir, "seeds", len(seeds), "tokens", len(tokens), "command", cmd+" -- "+cfg.exe)
+	return nil
+}
+
+// targetSeeds returns the encoded seeds of the fuzz target of cfg, or none if
+// it is not a native fuzz target.
+func targetSeeds(cfg *buildConfig) ([][]byte, error) {
+	pkg, err := resolvePackage(cfg.pkg, cfg.fuzzFunc, cfg.tags)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := fuzzTargets(pkg)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range targets {
+		if t.name == cfg.fuzzFunc {
+			return encodeSeeds(t, cfg.tags)
+		}
+	}
+	return nil, nil
+}
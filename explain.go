@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/holiman/gofuzz-shim/input"
+	shimtesting "github.com/holiman/gofuzz-shim/testing"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	explainCommand = &cli.Command{
+		Name:      "explain",
+		Usage:     "Show how the bytes of an input are decoded into the arguments of a fuzz target",
+		ArgsUsage: "<input-file> [<input-file>...]",
+		Flags: []cli.Flag{
+			fuzzFlag,
+			sourceFlag,
+			argTypesFlag,
+			minLensFlag,
+			tagsFlag,
+		},
+		Action: explain,
+	}
+
+	sourceFlag = &cli.StringSliceFlag{
+		Name:  "source",
+		Usage: "Source file(s) to search for the fuzz target, to determine its argument types",
+	}
+
+	argTypesFlag = &cli.StringSliceFlag{
+		Name:  "args",
+		Usage: `The argument types of the fuzz target (excluding *testing.T), instead of --source. Example: '--args=uint64,string,[]byte'`,
+	}
+)
+
+// builtinTypes maps the names of the types supported by explain to the
+// corresponding type.
+var builtinTypes = map[string]reflect.Type{
+	"int":        reflect.TypeOf(int(0)),
+	"int8":       reflect.TypeOf(int8(0)),
+	"int16":      reflect.TypeOf(int16(0)),
+	"int32":      reflect.TypeOf(int32(0)),
+	"rune":       reflect.TypeOf(rune(0)),
+	"int64":      reflect.TypeOf(int64(0)),
+	"uint":       reflect.TypeOf(uint(0)),
+	"uint8":      reflect.TypeOf(uint8(0)),
+	"byte":       reflect.TypeOf(byte(0)),
+	"uint16":     reflect.TypeOf(uint16(0)),
+	"uint32":     reflect.TypeOf(uint32(0)),
+	"uint64":     reflect.TypeOf(uint64(0)),
+	"uintptr":    reflect.TypeOf(uintptr(0)),
+	"float32":    reflect.TypeOf(float32(0)),
+	"float64":    reflect.TypeOf(float64(0)),
+	"complex64":  reflect.TypeOf(complex64(0)),
+	"complex128": reflect.TypeOf(complex128(0)),
+	"bool":       reflect.TypeOf(false),
+	"string":     reflect.TypeOf(""),
+
+	"input.UTF8String":      reflect.TypeOf(input.UTF8String("")),
+	"input.PrintableString": reflect.TypeOf(input.PrintableString("")),
+
+	"time.Time":      reflect.TypeOf(time.Time{}),
+	"time.Duration":  reflect.TypeOf(time.Duration(0)),
+	"big.Int":        reflect.TypeOf(big.Int{}),
+	"*big.Int":       reflect.TypeOf(new(big.Int)),
+	"netip.Addr":     reflect.TypeOf(netip.Addr{}),
+	"netip.AddrPort": reflect.TypeOf(netip.AddrPort{}),
+	"net.IP":         reflect.TypeOf(net.IP{}),
+	"url.URL":        reflect.TypeOf(url.URL{}),
+	"*url.URL":       reflect.TypeOf(new(url.URL)),
+}
+
+// typeOf returns the type with the given name, which is either one of the
+// builtinTypes, or a slice thereof.
+func typeOf(name string) (reflect.Type, bool) {
+	if elem, ok := strings.CutPrefix(name, "[]"); ok {
+		typ, ok := builtinTypes[elem]
+		if !ok {
+			return nil, false
+		}
+		return reflect.SliceOf(typ), true
+	}
+	typ, ok := builtinTypes[name]
+	return typ, ok
+}
+
+// fuzzFuncOf creates a (no-op) fuzz function taking the given argument types,
+// after the *testing.T.
+func fuzzFuncOf(args []string) (any, error) {
+	in := []reflect.Type{reflect.TypeOf(new(shimtesting.T))}
+	for _, name := range args {
+		typ, ok := typeOf(name)
+		if !ok {
+			return nil, fmt.Errorf("unsupported argument type %q", name)
+		}
+		in = append(in, typ)
+	}
+	typ := reflect.FuncOf(in, nil, false)
+	return reflect.MakeFunc(typ, func([]reflect.Value) []reflect.Value { return nil }).Interface(), nil
+}
+
+// fuzzArgsFromFlags returns the argument types given by the --args flag, or
+// found via the --source and --func flags.
+func fuzzArgsFromFlags(ctx *cli.Context) ([]string, error) {
+	var (
+		fuzzFunc = ctx.String(fuzzFlag.Name)
+		args     = ctx.StringSlice(argTypesFlag.Name)
+		err      error
+	)
+	if len(args) == 0 {
+		if args, err = fuzzArgs(ctx.StringSlice(sourceFlag.Name), fuzzFunc); err != nil {
+			return nil, err
+		}
+		if args == nil {
+			return nil, fmt.Errorf("fuzz target %v not found, use --source or --args", fuzzFunc)
+		}
+	}
+	return args, nil
+}
+
+// fuzzFuncFromFlags creates a fuzz function with the argument types given by
+// the --args flag, or found via the --source and --func flags.
+func fuzzFuncFromFlags(ctx *cli.Context) (any, error) {
+	args, err := fuzzArgsFromFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fuzzFuncOf(args)
+}
+
+func explain(ctx *cli.Context) error {
+	fn, err := fuzzFuncFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("no input files given")
+	}
+	// Decode as the fuzzer built with the same tags and minimum lengths does
+	tags := ctx.StringSlice(tagsFlag.Name)
+	opts := []input.ExplainOption{
+		input.ExplainMinLens(ctx.IntSlice(minLensFlag.Name)...),
+		input.ExplainPadPolicy(padPolicyForTags(tags)),
+		input.ExplainStringMode(stringModeForTags(tags)),
+	}
+	for _, path := range ctx.Args().Slice() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(ctx.App.Writer, "%v:\n%v\n", path, input.Explain(fn, data, opts...))
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"math"
+)
+
+// goCorpusHeader is the first line of corpus files in the format used by
+// 'go test -fuzz', in testdata/fuzz/<FuzzTarget>.
+const goCorpusHeader = "go test fuzz v1"
+
+// parseGoCorpus parses a corpus file in the format used by 'go test -fuzz',
+// and returns the values it holds.
+func parseGoCorpus(data []byte) ([]any, error) {
+	lines := bytes.Split(data, []byte("\n"))
+	if len(lines) == 0 || string(bytes.TrimSpace(lines[0])) != goCorpusHeader {
+		return nil, fmt.Errorf("missing %q header", goCorpusHeader)
+	}
+	var vals []any
+	for i, line := range lines[1:] {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		expr, err := parser.ParseExpr(string(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		val, err := parseGoValue(expr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
+
+// parseGoValue evaluates a (possibly converted) constant expression, as found
+// in go corpus files and in f.Add calls. Untyped constants get their default
+// type.
+func parseGoValue(expr ast.Expr) (any, error) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		val, err := constValue(expr)
+		if err != nil {
+			return nil, err
+		}
+		switch val.Kind() {
+		case constant.Bool:
+			return constant.BoolVal(val), nil
+		case constant.String:
+			return constant.StringVal(val), nil
+		case constant.Int:
+			if lit, ok := unparen(expr).(*ast.BasicLit); ok && lit.Kind == token.CHAR {
+				return convertConst(val, "rune")
+			}
+			return convertConst(val, "int")
+		case constant.Float:
+			return convertConst(val, "float64")
+		}
+		return nil, fmt.Errorf("unsupported constant %v", val)
+	}
+	if len(call.Args) != 1 {
+		return nil, fmt.Errorf("unsupported expression")
+	}
+	val, err := constValue(call.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return convertConst(val, fun.Name)
+	case *ast.ArrayType:
+		if elt, ok := fun.Elt.(*ast.Ident); ok && fun.Len == nil && (elt.Name == "byte" || elt.Name == "uint8") {
+			s, ok := stringConst(val)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert %v to []byte", val)
+			}
+			return []byte(s), nil
+		}
+	case *ast.SelectorExpr:
+		bits, ok := constant.Uint64Val(constant.ToInt(val))
+		if x, isIdent := fun.X.(*ast.Ident); ok && isIdent && x.Name == "math" {
+			switch fun.Sel.Name {
+			case "Float64frombits":
+				return math.Float64frombits(bits), nil
+			case "Float32frombits":
+				if bits <= math.MaxUint32 {
+					return math.Float32frombits(uint32(bits)), nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported expression")
+}
+
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		p, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = p.X
+	}
+}
+
+// constValue evaluates a literal, possibly negated, or true/false.
+func constValue(expr ast.Expr) (constant.Value, error) {
+	switch e := unparen(expr).(type) {
+	case *ast.BasicLit:
+		if val := constant.MakeFromLiteral(e.Value, e.Kind, 0); val.Kind() != constant.Unknown {
+			return val, nil
+		}
+	case *ast.UnaryExpr:
+		if e.Op == token.SUB || e.Op == token.ADD {
+			val, err := constValue(e.X)
+			if err != nil {
+				return nil, err
+			}
+			return constant.UnaryOp(e.Op, val, 0), nil
+		}
+	case *ast.Ident:
+		if e.Name == "true" || e.Name == "false" {
+			return constant.MakeBool(e.Name == "true"), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported value %v", expr)
+}
+
+// stringConst returns the string value of a string constant, or of an integer
+// constant converted to string (a rune).
+func stringConst(val constant.Value) (string, bool) {
+	switch val.Kind() {
+	case constant.String:
+		return constant.StringVal(val), true
+	case constant.Int:
+		r, ok := constant.Int64Val(val)
+		return string(rune(r)), ok
+	}
+	return "", false
+}
+
+// intBits maps the builtin integer types to their size in bits.
+var intBits = map[string]uint{
+	"int": 64, "int8": 8, "int16": 16, "int32": 32, "rune": 32, "int64": 64,
+	"uint": 64, "uint8": 8, "byte": 8, "uint16": 16, "uint32": 32, "uint64": 64, "uintptr": 64,
+}
+
+// convertConst converts a constant to the named builtin type.
+func convertConst(val constant.Value, typ string) (any, error) {
+	switch typ {
+	case "string":
+		if s, ok := stringConst(val); ok {
+			return s, nil
+		}
+	case "bool":
+		if val.Kind() == constant.Bool {
+			return constant.BoolVal(val), nil
+		}
+	case "float32", "float64":
+		// Float values need not be exact
+		f := constant.ToFloat(val)
+		if f.Kind() != constant.Float {
+			break
+		}
+		if typ == "float32" {
+			v, _ := constant.Float32Val(f)
+			return v, nil
+		}
+		v, _ := constant.Float64Val(f)
+		return v, nil
+	case "int", "int8", "int16", "int32", "rune", "int64":
+		bits := intBits[typ]
+		v, ok := constant.Int64Val(constant.ToInt(val))
+		if !ok || v < -1<<(bits-1) || v > 1<<(bits-1)-1 {
+			break
+		}
+		switch typ {
+		case "int":
+			return int(v), nil
+		case "int8":
+			return int8(v), nil
+		case "int16":
+			return int16(v), nil
+		case "int32", "rune":
+			return int32(v), nil
+		}
+		return v, nil
+	case "uint", "uint8", "byte", "uint16", "uint32", "uint64", "uintptr":
+		bits := intBits[typ]
+		v, ok := constant.Uint64Val(constant.ToInt(val))
+		if !ok || (bits < 64 && v >= 1<<bits) {
+			break
+		}
+		switch typ {
+		case "uint":
+			return uint(v), nil
+		case "uint8", "byte":
+			return uint8(v), nil
+		case "uint16":
+			return uint16(v), nil
+		case "uint32":
+			return uint32(v), nil
+		case "uintptr":
+			return uintptr(v), nil
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot convert %v to %v", val, typ)
+}
+
+// addedSeeds returns the arguments of the f.Add calls in the fuzz target
+// fuzzFunc, in the given files. Calls with arguments which are not constant
+// are skipped.
+func addedSeeds(paths []string, fuzzFunc string) ([][]any, error) {
+	fn, err := findFunc(paths, fuzzFunc)
+	if fn == nil || err != nil {
+		return nil, err
+	}
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) != 1 {
+		return nil, nil
+	}
+	f := params[0].Names[0].Name
+	var seeds [][]any
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Add" {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); !ok || x.Name != f {
+			return true
+		}
+		var args []any
+		for _, arg := range call.Args {
+			val, err := parseGoValue(arg)
+			if err != nil {
+				return true
+			}
+			args = append(args, val)
+		}
+		seeds = append(seeds, args)
+		return true
+	})
+	return seeds, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/holiman/gofuzz-shim/input"
+	"github.com/urfave/cli/v2"
+)
+
+var importCommand = &cli.Command{
+	Name:  "import118",
+	Usage: "Convert a go-118-fuzz-build corpus into the gofuzz-shim input layout",
+	Description: `Import decodes each file in the corpus directory the way go-118-fuzz-build does,
+and re-encodes the arguments in the gofuzz-shim input layout. Files for which
+go-118-fuzz-build would not have invoked the fuzz target are skipped.`,
+	ArgsUsage: "<corpus-dir>",
+	Flags: []cli.Flag{
+		fuzzFlag,
+		sourceFlag,
+		argTypesFlag,
+		outDirFlag,
+	},
+	Action: importGo118,
+}
+
+func importGo118(ctx *cli.Context) error {
+	fn, err := fuzzFuncFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("expected one corpus directory")
+	}
+	return convertCorpus(ctx.Args().First(), ctx.Path(outDirFlag.Name), func(data []byte) ([]byte, error) {
+		return input.ImportGo118(fn, data)
+	})
+}
@@ -0,0 +1,72 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// The fuzzing engine reuses the input buffer after each execution, so a target
+// which holds on to a byte slice argument (e.g. in a global or a goroutine),
+// or writes to it, may silently corrupt the buffer or later executions.
+//
+// In release mode, byte slice arguments are handed out as direct references
+// into the input buffer. If the build tag 'gofuzz_debug' is set, they are
+// instead copied, and after each invocation the source checks that neither
+// the input buffer nor the copies were written to by the target. Afterwards,
+// the copies are poisoned, so any reference retained by the target is easy
+// to spot.
+//
+// String arguments always hold a copy of the data, and need no checking.
+
+// poison is the byte written into byte slices after the invocation, in debug mode.
+const poison = 0xdb
+
+// aliasRecord tracks a byte slice which was handed out in debug mode.
+type aliasRecord struct {
+	offset int    // offset into the input buffer
+	data   []byte // the copy handed to the target
+}
+
+// getSlice returns size bytes for a byte slice argument. In debug mode, the
+// bytes are copied and recorded for the aliasing check.
+func (s *Source) getSlice(size int) []byte {
+	if !s.debug {
+		return s.getBytes(size)
+	}
+	offset := int(s.i)
+	data := bytes.Clone(s.getBytes(size))
+	if data == nil {
+		data = []byte{}
+	}
+	s.aliases = append(s.aliases, aliasRecord{offset, data})
+	return data
+}
+
+// checkAliasing verifies that the target did not modify the input buffer,
+// or any of the byte slices it was given, and then poisons the slices. It
+// panics if a modification is detected.
+func (s *Source) checkAliasing(snapshot []byte) {
+	defer func() {
+		for _, a := range s.aliases {
+			for i := range a.data {
+				a.data[i] = poison
+			}
+		}
+		s.aliases = nil
+	}()
+	if !bytes.Equal(snapshot, s.s) {
+		panic("gofuzz-shim: target modified the input buffer")
+	}
+	for i, a := range s.aliases {
+		// Only the part which was read from the input is checked, the
+		// remainder may be padding.
+		var want []byte
+		if a.offset < len(s.s) {
+			want = s.s[a.offset:min(a.offset+len(a.data), len(s.s))]
+		}
+		if !bytes.Equal(want, a.data[:len(want)]) {
+			panic(fmt.Sprintf("gofuzz-shim: target modified byte slice argument %d (input offset %d); "+
+				"in release mode this writes into the fuzzer's input buffer", i, a.offset))
+		}
+	}
+}
@@ -0,0 +1,5 @@
+//go:build gofuzz_debug
+
+package input
+
+const debugAliasing = true
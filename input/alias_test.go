@@ -0,0 +1,73 @@
+package input
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func debugSource(data []byte) *Source {
+	src := NewSource(data)
+	src.debug = true
+	return src
+}
+
+func TestAliasingRelease(t *testing.T) {
+	data := []byte("\x01\x01abcdef")
+	src := NewSource(data)
+	src.debug = false
+	src.FillAndCall(func(t *testing.T, a, b []byte) {
+		a[0] = 'x'
+	}, reflect.ValueOf(new(testing.T)))
+	if data[2] != 'x' {
+		t.Fatal("expected zero-copy argument")
+	}
+}
+
+func TestAliasingDebug(t *testing.T) {
+	var retained []byte
+	data := []byte("\x01\x01abcdef")
+	debugSource(data).FillAndCall(func(t *testing.T, a, b []byte) {
+		retained = b
+	}, reflect.ValueOf(new(testing.T)))
+	if string(data) != "\x01\x01abcdef" {
+		t.Fatalf("input modified: %q", data)
+	}
+	if string(retained) != "\xdb\xdb\xdb" {
+		t.Fatalf("retained slice not poisoned: %q", retained)
+	}
+}
+
+func TestAliasingDebugWrite(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(r.(string), "argument 1") {
+			t.Fatalf("expected aliasing panic, have %v", r)
+		}
+	}()
+	debugSource([]byte("\x01\x01abcdef")).FillAndCall(func(t *testing.T, a, b []byte) {
+		b[0] = 'x'
+	}, reflect.ValueOf(new(testing.T)))
+}
+
+func TestAliasingDebugPanic(t *testing.T) {
+	// A crash of the target must not be replaced by the aliasing check
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("expected original panic, have %v", r)
+		}
+	}()
+	debugSource([]byte("\x01\x01abcdef")).FillAndCall(func(t *testing.T, a, b []byte) {
+		b[0] = 'x'
+		panic("boom")
+	}, reflect.ValueOf(new(testing.T)))
+}
+
+func TestAliasingDebugExhausted(t *testing.T) {
+	// Reading past the end must not be mistaken for a modification
+	src := debugSource([]byte{0xff})
+	src.FillAndCall(func(t *testing.T, a uint16, b []byte) {}, reflect.ValueOf(new(testing.T)))
+	if !src.IsExhausted() {
+		t.Fatal("expected exhausted")
+	}
+}
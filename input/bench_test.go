@@ -0,0 +1,77 @@
+package input
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReaderAllocs(t *testing.T) {
+	data := fibonacci(64)
+	for _, tc := range []struct {
+		name string
+		fn   func(s *Source)
+	}{
+		{"getBytes-all", func(s *Source) { s.getBytes(64) }},
+		{"getBytes-last", func(s *Source) { s.getBytes(60); s.getBytes(4) }},
+		{"readUint64", func(s *Source) { s.readUint(reflect.Uint64) }},
+		{"readUint64-last", func(s *Source) { s.getBytes(56); s.readUint(reflect.Uint64) }},
+		{"readInt16-exhausted", func(s *Source) { s.getBytes(63); s.readInt(reflect.Int16) }},
+		{"readFloat64", func(s *Source) { s.readFloat(reflect.Float64) }},
+	} {
+		s := new(Source)
+		allocs := testing.AllocsPerRun(100, func() {
+			*s = Source{s: data}
+			tc.fn(s)
+		})
+		if allocs != 0 {
+			t.Errorf("%v: have %v allocs, want 0", tc.name, allocs)
+		}
+	}
+}
+
+func BenchmarkGetBytes(b *testing.B) {
+	data := fibonacci(1024)
+	b.Run("middle", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s := Source{s: data}
+			s.getBytes(512)
+		}
+	})
+	b.Run("last", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s := Source{s: data}
+			s.getBytes(1024)
+		}
+	})
+	b.Run("exhausted", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s := Source{s: data}
+			s.getBytes(1025)
+		}
+	})
+}
+
+func BenchmarkReadScalars(b *testing.B) {
+	data := fibonacci(15)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s := Source{s: data}
+		s.readUint(reflect.Uint8)
+		s.readUint(reflect.Uint16)
+		s.readInt(reflect.Int32)
+		s.readInt(reflect.Int64)
+	}
+}
+
+func BenchmarkFillAndCall(b *testing.B) {
+	data := fibonacci(256)
+	fuzzFunc := func(t *testing.T, a uint64, b int32, c bool, d []byte, e string) {}
+	arg0 := reflect.ValueOf(new(testing.T))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewSource(data).FillAndCall(fuzzFunc, arg0)
+	}
+}
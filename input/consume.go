@@ -0,0 +1,77 @@
+package input
+
+import (
+	"bytes"
+	"reflect"
+)
+
+// The methods in this file form a typed API for decoding arguments, without
+// reflection. Used in the same order as FillAndCall would (fixed-size arguments
+// first, then the dynamic-sized arguments via Split), they decode exactly the
+// same values from the same input. Strings and byte slices have an element
+// size of 1.
+
+func (s *Source) ConsumeInt() int         { return int(s.readInt(reflect.Int)) }
+func (s *Source) ConsumeInt8() int8       { return int8(s.readInt(reflect.Int8)) }
+func (s *Source) ConsumeInt16() int16     { return int16(s.readInt(reflect.Int16)) }
+func (s *Source) ConsumeInt32() int32     { return int32(s.readInt(reflect.Int32)) }
+func (s *Source) ConsumeInt64() int64     { return s.readInt(reflect.Int64) }
+func (s *Source) ConsumeUint() uint       { return uint(s.readUint(reflect.Uint)) }
+func (s *Source) ConsumeUint8() uint8     { return uint8(s.readUint(reflect.Uint8)) }
+func (s *Source) ConsumeUint16() uint16   { return uint16(s.readUint(reflect.Uint16)) }
+func (s *Source) ConsumeUint32() uint32   { return uint32(s.readUint(reflect.Uint32)) }
+func (s *Source) ConsumeUint64() uint64   { return s.readUint(reflect.Uint64) }
+func (s *Source) ConsumeUintptr() uintptr { return uintptr(s.readUint(reflect.Uintptr)) }
+func (s *Source) ConsumeFloat32() float32 { return float32(s.readFloat(reflect.Float32)) }
+func (s *Source) ConsumeFloat64() float64 { return s.readFloat(reflect.Float64) }
+func (s *Source) ConsumeBool() bool       { return s.readUint(reflect.Uint8)&0x1 != 0 }
+func (s *Source) ConsumeComplex64() complex64 {
+	re := s.readFloat(reflect.Float32)
+	im := s.readFloat(reflect.Float32)
+	return complex64(complex(re, im))
+}
+func (s *Source) ConsumeComplex128() complex128 {
+	re := s.readFloat(reflect.Float64)
+	im := s.readFloat(reflect.Float64)
+	return complex(re, im)
+}
+
+// ConsumeString returns a string of size bytes, decoded according to the
+// string mode of the source.
+func (s *Source) ConsumeString(size int) string {
+	if !s.allocate(size, 1) {
+		return ""
+	}
+	return decodeString(s.getBytes(size), s.strMode)
+}
+
+// ConsumeBytes returns a byte slice of size bytes.
+func (s *Source) ConsumeBytes(size int) []byte {
+	if !s.enter() {
+		return nil
+	}
+	defer s.leave()
+	if !s.allocate(size, 1) {
+		return nil
+	}
+	return s.getSlice(size)
+}
+
+// Invoke calls fn, which is expected to invoke the fuzz target with the decoded
+// arguments. In debug mode, it checks for aliasing afterwards, unless fn
+// panicked, so that the original panic is not masked.
+// It returns false, without calling fn, if the input was insufficient and
+// the padding policy is PadSkip.
+func (s *Source) Invoke(fn func()) bool {
+	if s.exhausted && s.pad == PadSkip {
+		return false
+	}
+	if !s.debug {
+		fn()
+		return true
+	}
+	snapshot := bytes.Clone(s.s)
+	fn()
+	s.checkAliasing(snapshot)
+	return true
+}
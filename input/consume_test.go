@@ -0,0 +1,34 @@
+package input
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestConsumeMatchesFillAndCall checks that the typed API decodes the same
+// values as FillAndCall.
+func TestConsumeMatchesFillAndCall(t *testing.T) {
+	var have string
+	fuzzFunc := func(t *testing.T, a uint16, s string, b bool, d []byte, c complex64, e int, f uintptr) {
+		have = fmt.Sprintf("%v %q %v %q %v %v %v", a, s, b, d, c, e, f)
+	}
+	for size := 2; size < 64; size++ {
+		data := fibonacci(size)
+		NewSource(data).FillAndCall(fuzzFunc, reflect.ValueOf(new(testing.T)))
+
+		src := NewSource(data)
+		a := src.ConsumeUint16()
+		b := src.ConsumeBool()
+		c := src.ConsumeComplex64()
+		e := src.ConsumeInt()
+		f := src.ConsumeUintptr()
+		split := src.Split(1, 1)
+		s := src.ConsumeString(split.Next())
+		d := src.ConsumeBytes(split.Next())
+		want := fmt.Sprintf("%v %q %v %q %v %v %v", a, s, b, d, c, e, f)
+		if have != want {
+			t.Fatalf("size %d: mismatch\nhave %v\nwant %v", size, have, want)
+		}
+	}
+}
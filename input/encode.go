@@ -0,0 +1,241 @@
+package input
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// Encode returns an input (without header) which decodes into the given
+// arguments for the fuzz function fn, using the current layout. The args
+// exclude the first argument of fn.
+func Encode(fn any, args ...any) ([]byte, error) {
+	return EncodeMode(defaultStringMode, fn, args...)
+}
+
+// EncodeMode is like Encode, but encodes plain string arguments for decoding in
+// the given mode, for fuzzers built with other tags than the caller.
+func EncodeMode(mode StringMode, fn any, args ...any) ([]byte, error) {
+	vals := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		vals[i] = reflect.ValueOf(arg)
+	}
+	return encodeValues(fn, vals, mode)
+}
+
+// EncodeValues is like Encode, but takes reflect values.
+func EncodeValues(fn any, args []reflect.Value) ([]byte, error) {
+	return encodeValues(fn, args, defaultStringMode)
+}
+
+func encodeValues(fn any, args []reflect.Value, mode StringMode) ([]byte, error) {
+	p := planFor(reflect.TypeOf(fn))
+	if len(args) != len(p.in)-1 {
+		return nil, fmt.Errorf("wrong number of arguments: have %d, want %d", len(args), len(p.in)-1)
+	}
+	args = append([]reflect.Value(nil), args...)
+	for i, arg := range args {
+		if !arg.IsValid() || !arg.Type().ConvertibleTo(p.in[i+1]) {
+			return nil, fmt.Errorf("argument %d: cannot use %v as %v", i+1, arg, p.in[i+1])
+		}
+		args[i] = arg.Convert(p.in[i+1])
+	}
+	var (
+		out  []byte
+		dyn  [][]byte
+		lens []int
+		err  error
+	)
+	for _, i := range p.fixed {
+		if out, err = encodeValue(out, args[i-1], mode); err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+	}
+	for j, i := range p.dynamic {
+		enc, err := encodeValue(nil, args[i-1], mode)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		dyn = append(dyn, enc)
+		lens = append(lens, len(enc)/p.elemSizes[j])
+	}
+	weights, err := findWeights(p.elemSizes, lens)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, weights...)
+	for _, enc := range dyn {
+		out = append(out, enc...)
+	}
+	return out, nil
+}
+
+// findWeights finds weights, which make a Splitter (without minimum lengths)
+// split the input into arguments of the given lengths.
+func findWeights(elemSizes, lens []int) ([]byte, error) {
+	n := len(lens)
+	weights := make([]byte, n)
+	if n <= 1 {
+		return weights, nil
+	}
+	var free int
+	for i := range lens {
+		free += lens[i] * elemSizes[i]
+	}
+	// fits reports whether argument i gets the right length, with weight w of sum
+	fits := func(i, w, sum int) bool {
+		var share int
+		if sum == 0 {
+			share = free / n
+		} else {
+			share = free * w / sum
+		}
+		return share/elemSizes[i] == lens[i]
+	}
+	// Try all-zero weights first
+	ok := true
+	for i := 0; i < n-1 && ok; i++ {
+		ok = fits(i, 0, 0)
+	}
+	if ok {
+		return weights, nil
+	}
+	for sum := 1; sum <= 255*n; sum++ {
+		rest, ok := sum, true
+		for i := 0; i < n-1 && ok; i++ {
+			// The smallest weight giving at least the wanted length
+			w := (lens[i]*elemSizes[i]*sum + free - 1) / free
+			if ok = w <= 255 && w <= rest && fits(i, w, sum); ok {
+				weights[i] = byte(w)
+				rest -= w
+			}
+		}
+		if ok && rest <= 255 {
+			weights[n-1] = byte(rest)
+			return weights, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot represent argument lengths %v", lens)
+}
+
+// encodeValue appends the encoding of v to out. Strings are encoded for
+// decoding in the given mode, or the mode of their type (see Source.stringMode).
+func encodeValue(out []byte, v reflect.Value, mode StringMode) ([]byte, error) {
+	typ := v.Type()
+	if typ.Kind() == reflect.Pointer && v.IsNil() {
+		v = reflect.New(typ.Elem())
+	}
+	switch x := v.Interface().(type) {
+	case time.Time:
+		secs := x.Unix()
+		if secs < minUnixTime || secs > maxUnixTime {
+			return nil, fmt.Errorf("time %v out of range", x)
+		}
+		out = appendUint(out, uint64(secs), 8)
+		return appendUint(out, uint64(x.Nanosecond()), 4), nil
+	case big.Int:
+		return encodeBigInt(out, &x)
+	case *big.Int:
+		return encodeBigInt(out, x)
+	case netip.Addr:
+		return encodeAddr(out, x)
+	case netip.AddrPort:
+		out, err := encodeAddr(out, x.Addr())
+		return appendUint(out, uint64(x.Port()), 2), err
+	case net.IP:
+		addr, ok := netip.AddrFromSlice(x)
+		if !ok {
+			return nil, fmt.Errorf("invalid IP %v", x)
+		}
+		return encodeAddr(out, addr)
+	case url.URL:
+		return append(out, x.String()...), nil
+	case *url.URL:
+		return append(out, x.String()...), nil
+	}
+	switch k := typ.Kind(); k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendUint(out, uint64(v.Int()), fixedSize(k)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendUint(out, v.Uint(), fixedSize(k)), nil
+	case reflect.Float32:
+		return appendUint(out, uint64(math.Float32bits(float32(v.Float()))), 4), nil
+	case reflect.Float64:
+		return appendUint(out, math.Float64bits(v.Float()), 8), nil
+	case reflect.Complex64:
+		c := v.Complex()
+		out = appendUint(out, uint64(math.Float32bits(float32(real(c)))), 4)
+		return appendUint(out, uint64(math.Float32bits(float32(imag(c)))), 4), nil
+	case reflect.Complex128:
+		c := v.Complex()
+		out = appendUint(out, math.Float64bits(real(c)), 8)
+		return appendUint(out, math.Float64bits(imag(c)), 8), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return append(out, 1), nil
+		}
+		return append(out, 0), nil
+	case reflect.String:
+		switch typ {
+		case utf8StringType:
+			mode = StringUTF8
+		case printableStringType:
+			mode = StringPrintable
+		}
+		enc, ok := EncodeString(v.String(), mode)
+		if !ok {
+			return nil, fmt.Errorf("string %q cannot be decoded in the string mode of %v", v.String(), typ)
+		}
+		return append(out, enc...), nil
+	case reflect.Slice:
+		if fixedSize(typ.Elem().Kind()) == 0 {
+			break
+		}
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return append(out, v.Bytes()...), nil
+		}
+		var err error
+		for i := 0; i < v.Len() && err == nil; i++ {
+			out, err = encodeValue(out, v.Index(i), mode)
+		}
+		return out, err
+	}
+	return nil, fmt.Errorf("unsupported type: %v", typ)
+}
+
+func encodeBigInt(out []byte, x *big.Int) ([]byte, error) {
+	mag := x.Bytes()
+	if len(mag) > 0x7f {
+		return nil, fmt.Errorf("integer too large: %d bytes", len(mag))
+	}
+	hdr := byte(len(mag))
+	if x.Sign() < 0 {
+		hdr |= 0x80
+	}
+	return append(append(out, hdr), mag...), nil
+}
+
+func encodeAddr(out []byte, addr netip.Addr) ([]byte, error) {
+	switch {
+	case addr.Is4():
+		a := addr.As4()
+		return append(append(out, 0), a[:]...), nil
+	case addr.Is6() && addr.Zone() == "":
+		a := addr.As16()
+		return append(append(out, 1), a[:]...), nil
+	}
+	return nil, fmt.Errorf("cannot encode address %v", addr)
+}
+
+// appendUint appends the lowest size bytes of v, big-endian.
+func appendUint(out []byte, v uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		out = append(out, byte(v>>(8*i)))
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package input
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// maxExplainBytes is the maximum number of raw bytes shown per argument.
+const maxExplainBytes = 32
+
+// ExplainOption configures the decoding done by Explain, to match the settings
+// of the fuzzer which ran the input.
+type ExplainOption func(*Source)
+
+// ExplainMinLens sets the minimum lengths of the dynamic-sized arguments, see
+// Source.SetMinLens.
+func ExplainMinLens(lens ...int) ExplainOption {
+	return func(s *Source) { s.SetMinLens(lens...) }
+}
+
+// ExplainPadPolicy sets the padding policy, see Source.SetPadPolicy.
+func ExplainPadPolicy(p PadPolicy) ExplainOption {
+	return func(s *Source) { s.SetPadPolicy(p) }
+}
+
+// ExplainStringMode sets the mode used to decode string arguments, see
+// Source.SetStringMode.
+func ExplainStringMode(mode StringMode) ExplainOption {
+	return func(s *Source) { s.SetStringMode(mode) }
+}
+
+// Explain decodes data as input for the fuzz function fn, in the same way as
+// FillAndCall does, but instead of invoking fn it returns a report describing
+// which bytes were used for which argument, and how they were interpreted.
+// The first argument of fn (the *testing.T) is ignored. Without options, the
+// defaults of NewSource are used.
+func Explain(fn any, data []byte, opts ...ExplainOption) string {
+	var (
+		p = planFor(reflect.TypeOf(fn))
+		s = NewSource(data)
+		b strings.Builder
+	)
+	for _, opt := range opts {
+		opt(s)
+	}
+	if len(s.s) != len(data) {
+		fmt.Fprintf(&b, "header: layout version %d\n", s.version)
+		data = s.s
+	}
+	fmt.Fprintf(&b, "input: %d bytes\n", len(data))
+	explainArg := func(i, size int, note string) {
+		start, padded := s.Used(), s.padded
+		v := s.fillArg(p.in[i], size)
+		end := s.Used()
+		fmt.Fprintf(&b, "arg %d (%v): bytes [%d:%d] %v", i, p.in[i], start, end, explainBytes(data[start:end]))
+		if note != "" {
+			fmt.Fprintf(&b, " %v", note)
+		}
+		fmt.Fprintf(&b, " => %v", explainValue(v))
+		b.WriteString(padNote(s, s.padded-padded) + "\n")
+	}
+	for _, i := range p.fixed {
+		explainArg(i, 0, "")
+	}
+	if len(p.dynamic) > 0 {
+		start, padded := s.Used(), s.padded
+		split := s.Split(p.elemSizes...)
+		fmt.Fprintf(&b, "weights: bytes [%d:%d] %v (sum %d, %d bytes to distribute)",
+			start, s.Used(), split.weights, split.sum, split.free)
+		b.WriteString(padNote(s, s.padded-padded) + "\n")
+		for j, i := range p.dynamic {
+			note := "(remainder)"
+			if j < len(p.dynamic)-1 {
+				note = fmt.Sprintf("(weight %d)", split.weights[j])
+			}
+			n := split.Next()
+			if split.skipped > 0 {
+				fmt.Fprintf(&b, "skipped: %d bytes (not a whole element)\n", split.skipped)
+			}
+			explainArg(i, n, note)
+		}
+	}
+	if n := s.Len(); n > 0 {
+		fmt.Fprintf(&b, "unused: %d bytes\n", n)
+	}
+	if s.IsExhausted() {
+		if s.pad == PadSkip {
+			b.WriteString("input exhausted: the target would not be invoked\n")
+		} else {
+			b.WriteString("input exhausted: the input would be rejected\n")
+		}
+	}
+	return b.String()
+}
+
+// padNote returns a note about n padded bytes, if any.
+func padNote(s *Source, n int) string {
+	switch {
+	case n == 0:
+		return ""
+	case s.pad == PadWrap:
+		return fmt.Sprintf(" (WRAPPED: %d bytes)", n)
+	}
+	return fmt.Sprintf(" (ZERO-PADDED: %d bytes)", n)
+}
+
+// explainBytes formats raw input bytes as hex, truncated if needed.
+func explainBytes(data []byte) string {
+	if len(data) > maxExplainBytes {
+		return fmt.Sprintf("0x%x...", data[:maxExplainBytes])
+	}
+	return "0x" + hex.EncodeToString(data)
+}
+
+// explainValue formats a decoded argument.
+func explainValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	case reflect.Slice:
+		if v.Type() == reflect.TypeOf([]byte{}) {
+			return fmt.Sprintf("%q", v.Bytes())
+		}
+	case reflect.Struct:
+		// E.g. big.Int and url.URL implement Stringer on the pointer
+		if v.CanAddr() {
+			if st, ok := v.Addr().Interface().(fmt.Stringer); ok {
+				return st.String()
+			}
+		}
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
@@ -0,0 +1,53 @@
+package input
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	fuzzFunc := func(t *testing.T, a uint16, s1, s2 string, b bool) {}
+	have := Explain(fuzzFunc, []byte("\x01\x02\x01\x02\x03abcdefghi"))
+	want := `input: 14 bytes
+arg 1 (uint16): bytes [0:2] 0x0102 => 258
+arg 4 (bool): bytes [2:3] 0x01 => true
+weights: bytes [3:5] [2 3] (sum 5, 9 bytes to distribute)
+arg 2 (string): bytes [5:8] 0x616263 (weight 2) => "abc"
+arg 3 (string): bytes [8:14] 0x646566676869 (remainder) => "defghi"
+`
+	if have != want {
+		t.Fatalf("have\n%v\nwant\n%v", have, want)
+	}
+}
+
+func TestExplainOptions(t *testing.T) {
+	fuzzFunc := func(t *testing.T, s string, b []byte) {}
+	have := Explain(fuzzFunc, []byte("\x00\x00abcd"),
+		ExplainMinLens(3), ExplainStringMode(StringPrintable), ExplainPadPolicy(PadSkip))
+	want := `input: 6 bytes
+weights: bytes [0:2] [0 0] (sum 0, 1 bytes to distribute)
+arg 1 (string): bytes [2:5] 0x616263 (weight 0) => "\"#$"
+arg 2 ([]uint8): bytes [5:6] 0x64 (remainder) => "d"
+`
+	if have != want {
+		t.Fatalf("have\n%v\nwant\n%v", have, want)
+	}
+	have = Explain(fuzzFunc, []byte("\x00\x00ab"), ExplainMinLens(3), ExplainPadPolicy(PadSkip))
+	if !strings.HasSuffix(have, "input exhausted: the target would not be invoked\n") {
+		t.Fatalf("have\n%v", have)
+	}
+}
+
+func TestExplainExhausted(t *testing.T) {
+	fuzzFunc := func(t *testing.T, a uint32, b []byte) {}
+	have := Explain(fuzzFunc, []byte{0xff, 0xee})
+	want := `input: 2 bytes
+arg 1 (uint32): bytes [0:2] 0xffee => 4293787648 (ZERO-PADDED: 2 bytes)
+weights: bytes [2:2] [0] (sum 0, 0 bytes to distribute) (ZERO-PADDED: 1 bytes)
+arg 2 ([]uint8): bytes [2:2] 0x (remainder) => ""
+input exhausted: the input would be rejected
+`
+	if have != want {
+		t.Fatalf("have\n%v\nwant\n%v", have, want)
+	}
+}
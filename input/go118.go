@@ -0,0 +1,239 @@
+package input
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// This file implements the input decoding of go-118-fuzz-build, which uses
+// the ConsumeFuzzer from go-fuzz-headers, so that corpora built for it can be
+// converted into the layout used here.
+
+var errGo118Short = errors.New("not enough data")
+
+// go118MaxTotalLen mirrors MaxTotalLen in go-fuzz-headers.
+const go118MaxTotalLen = 2000000
+
+// go118Consumer mirrors the parts of go-fuzz-headers' ConsumeFuzzer which
+// are used by go-118-fuzz-build.
+type go118Consumer struct {
+	data     []byte
+	position uint32
+}
+
+func (c *go118Consumer) total() uint32 { return uint32(len(c.data)) }
+
+func (c *go118Consumer) getByte() (byte, error) {
+	if c.position >= c.total() {
+		return 0, errGo118Short
+	}
+	b := c.data[c.position]
+	c.position++
+	return b, nil
+}
+
+func (c *go118Consumer) getNBytes(n int) ([]byte, error) {
+	if c.position >= c.total() {
+		return nil, errGo118Short
+	}
+	out := make([]byte, 0, n)
+	for i := 0; i < n; i++ {
+		b, err := c.getByte()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// getBool returns true for even bytes.
+func (c *go118Consumer) getBool() (bool, error) {
+	b, err := c.getByte()
+	return b%2 == 0, err
+}
+
+// getUint reads n bytes, followed (except for n == 4) by a bool which selects
+// little-endian decoding.
+func (c *go118Consumer) getUint(n int) (uint64, error) {
+	data, err := c.getNBytes(n)
+	if err != nil {
+		return 0, err
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if n != 4 {
+		littleEndian, err := c.getBool()
+		if err != nil {
+			return 0, err
+		}
+		if littleEndian {
+			order = binary.LittleEndian
+		}
+	}
+	switch n {
+	case 2:
+		return uint64(order.Uint16(data)), nil
+	case 4:
+		return uint64(order.Uint32(data)), nil
+	}
+	return order.Uint64(data), nil
+}
+
+func (c *go118Consumer) getFloat(n int) (float64, error) {
+	data, err := c.getNBytes(n)
+	if err != nil {
+		return 0, err
+	}
+	littleEndian, err := c.getBool()
+	if err != nil {
+		return 0, err
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if littleEndian {
+		order = binary.LittleEndian
+	}
+	if n == 4 {
+		return float64(math.Float32frombits(order.Uint32(data))), nil
+	}
+	return math.Float64frombits(order.Uint64(data)), nil
+}
+
+func (c *go118Consumer) getBytes() ([]byte, error) {
+	length32, err := c.getUint(4)
+	if err != nil {
+		return nil, err
+	}
+	length := uint32(length32)
+	if length == 0 {
+		length = 30
+	}
+	bytesLeft := c.total() - c.position
+	if bytesLeft == 0 {
+		return nil, errGo118Short
+	}
+	if length != bytesLeft {
+		length = length % bytesLeft
+	}
+	begin := c.position
+	c.position = begin + length
+	return c.data[begin:c.position], nil
+}
+
+func (c *go118Consumer) getString() (string, error) {
+	if c.position >= c.total() {
+		return "", errGo118Short
+	}
+	length32, err := c.getUint(4)
+	if err != nil {
+		return "", err
+	}
+	length := uint32(length32)
+	begin := c.position
+	if begin > go118MaxTotalLen || begin >= c.total() || begin+length > c.total() || begin > begin+length {
+		return "", errGo118Short
+	}
+	c.position = begin + length
+	return string(c.data[begin:c.position]), nil
+}
+
+// DecodeGo118 decodes data into the arguments (excluding the first) of the
+// fuzz function fn, the same way as go-118-fuzz-build does. It returns an
+// error if go-118-fuzz-build would not have invoked fn, due to insufficient
+// data, or if fn has an argument type which it does not support.
+func DecodeGo118(fn any, data []byte) ([]reflect.Value, error) {
+	var (
+		typ  = reflect.TypeOf(fn)
+		c    = &go118Consumer{data: data}
+		vals []reflect.Value
+	)
+	if typ.Kind() != reflect.Func {
+		return nil, fmt.Errorf("wrong type: %v", typ)
+	}
+	for i := 1; i < typ.NumIn(); i++ {
+		var (
+			v   = reflect.New(typ.In(i)).Elem()
+			err error
+		)
+		// Like go-118-fuzz-build, switch on the type name. Named types are
+		// not supported.
+		switch v.Type().String() {
+		case "[]uint8":
+			var b []byte
+			b, err = c.getBytes()
+			v.SetBytes(b)
+		case "string":
+			var s string
+			s, err = c.getString()
+			v.SetString(s)
+		case "int", "int64":
+			var x uint64
+			x, err = c.getUint(8)
+			v.SetInt(int64(x))
+		case "int8":
+			var x byte
+			x, err = c.getByte()
+			v.SetInt(int64(int8(x)))
+		case "int16":
+			var x uint64
+			x, err = c.getUint(2)
+			v.SetInt(int64(int16(x)))
+		case "int32":
+			var x uint64
+			x, err = c.getUint(4)
+			v.SetInt(int64(int32(x)))
+		case "uint", "uint64":
+			var x uint64
+			x, err = c.getUint(8)
+			v.SetUint(x)
+		case "uint8":
+			var x byte
+			x, err = c.getByte()
+			v.SetUint(uint64(x))
+		case "uint16":
+			var x uint64
+			x, err = c.getUint(2)
+			v.SetUint(x)
+		case "uint32":
+			var x uint64
+			x, err = c.getUint(4)
+			v.SetUint(x)
+		case "float32":
+			var x float64
+			x, err = c.getFloat(4)
+			v.SetFloat(x)
+		case "float64":
+			var x float64
+			x, err = c.getFloat(8)
+			v.SetFloat(x)
+		case "bool":
+			var x bool
+			x, err = c.getBool()
+			v.SetBool(x)
+		default:
+			return nil, fmt.Errorf("argument %d: type %v not supported by go-118-fuzz-build", i, v.Type())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// ImportGo118 converts a go-118-fuzz-build input for the fuzz function fn into
+// an input (with header) in the current layout, which decodes into the same
+// arguments.
+func ImportGo118(fn any, data []byte) ([]byte, error) {
+	vals, err := DecodeGo118(fn, data)
+	if err != nil {
+		return nil, err
+	}
+	out, err := EncodeValues(fn, vals)
+	if err != nil {
+		return nil, err
+	}
+	return AddHeader(out), nil
+}
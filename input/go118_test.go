@@ -0,0 +1,84 @@
+package input
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func valuesString(vals []reflect.Value) string {
+	var have []any
+	for _, v := range vals {
+		have = append(have, v.Interface())
+	}
+	return fmt.Sprint(have)
+}
+
+func TestDecodeGo118(t *testing.T) {
+	fuzzFunc := func(t *testing.T, a uint16, b []byte, c string, d bool, e int8, f uint32, g int) {}
+	data := []byte{
+		0x01, 0x02, 0x01, // a: big-endian (odd bool byte)
+		0x00, 0x00, 0x00, 0x03, // b: length 3
+		'a', 'b', 'c',
+		0x00, 0x00, 0x00, 0x02, // c: length 2
+		'x', 'y',
+		0x02,                   // d: even => true
+		0xff,                   // e
+		0x00, 0x00, 0x01, 0x00, // f: always big-endian
+		0x01, 0, 0, 0, 0, 0, 0, 0, 0x00, // g: little-endian
+	}
+	vals, err := DecodeGo118(fuzzFunc, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := valuesString(vals)
+	if want := "[258 [97 98 99] xy true -1 256 1]"; have != want {
+		t.Fatalf("have %v want %v", have, want)
+	}
+	// Truncated input: go-118-fuzz-build would not invoke the target
+	if _, err := DecodeGo118(fuzzFunc, data[:len(data)-1]); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecodeGo118Bytes(t *testing.T) {
+	fuzzFunc := func(t *testing.T, b []byte) {}
+	for i, tc := range []struct {
+		data []byte
+		want string
+	}{
+		// Length 0 means 30, modulo the bytes left
+		{[]byte{0, 0, 0, 0, 1, 2, 3, 4}, "[[1 2]]"},
+		// Length equal to bytes left is kept
+		{[]byte{0, 0, 0, 4, 1, 2, 3, 4}, "[[1 2 3 4]]"},
+		{[]byte{0, 0, 0, 7, 1, 2, 3, 4}, "[[1 2 3]]"},
+	} {
+		vals, err := DecodeGo118(fuzzFunc, tc.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := valuesString(vals); have != tc.want {
+			t.Errorf("test %d: have %v want %v", i, have, tc.want)
+		}
+	}
+}
+
+func TestImportGo118(t *testing.T) {
+	fuzzFunc := func(t *testing.T, a []byte, s string, n uint64) {}
+	data := []byte{
+		0, 0, 0, 2, 'a', 'b',
+		0, 0, 0, 3, 'c', 'd', 'e',
+		0, 0, 0, 0, 0, 0, 0, 5, 1,
+	}
+	out, err := ImportGo118(fuzzFunc, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals, err := Decode(fuzzFunc, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := valuesString(vals), "[[97 98] cde 5]"; have != want {
+		t.Fatalf("have %v want %v", have, want)
+	}
+}
@@ -0,0 +1,223 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// LayoutVersion is the version of the input layout, i.e. the way input bytes
+// are mapped to arguments. It is bumped whenever that mapping changes, so that
+// existing corpora can be told apart, and upgraded (see Decode and Encode).
+//
+// History:
+//
+//	1: The original layout: fixed-size arguments are read big-endian, followed by
+//	   a weight byte per dynamic-sized argument (strings and byte slices), which
+//	   determine how the remaining input is split.
+//	2: Dynamic-sized arguments are split in units of their element size, and
+//	   time, big.Int, IP address and URL arguments are supported. Inputs for
+//	   signatures which were supported by layout 1 decode identically.
+const LayoutVersion = 2
+
+// headerMagic is the start of a layout header.
+const headerMagic = "\xffGFS"
+
+// layout holds the decoder for a layout version.
+type layout struct {
+	// compatible is set if inputs of the previous version, for argument types
+	// supported by it, decode identically in this version.
+	compatible bool
+	// supports reports whether the argument type can be decoded by the layout.
+	supports func(typ reflect.Type) bool
+	// decode fills the arguments (except the first) from the source.
+	decode func(s *Source, p *plan, args []reflect.Value)
+}
+
+// layouts holds the decoders for all layout versions, including old ones.
+var layouts = map[int]layout{
+	1: {supports: supportedV1, decode: (*Source).decodeArgsV1},
+	2: {supports: supportedV2, decode: (*Source).decodeArgs, compatible: true},
+}
+
+// decodeArgsV1 fills the arguments (except the first) according to layout 1.
+// It is frozen, and must not change along with the current layout. Minimum
+// lengths did not exist in layout 1, and are ignored. Signatures which are
+// not supported by layout 1 are decoded with the current layout instead, so a
+// stray header in fuzzer-generated input does not crash the target.
+func (s *Source) decodeArgsV1(p *plan, args []reflect.Value) {
+	for _, typ := range p.in[1:] {
+		if !supportedV1(typ) {
+			s.decodeArgs(p, args)
+			return
+		}
+	}
+	// Fill all fixed-size arguments first, then dynamic-sized fields.
+	var dynamic []int
+	for i := 1; i < len(p.in); i++ {
+		if p.in[i].Kind() <= reflect.Float64 {
+			s.fillV1(args[i], 0)
+		} else {
+			dynamic = append(dynamic, i)
+		}
+	}
+	// The relative weights determine how much of the remaining input each
+	// dynamic-sized argument gets, the last one gets all that is left.
+	weights := s.getBytes(len(dynamic))
+	sum := 0
+	for _, w := range weights {
+		sum += int(w)
+	}
+	bytesLeft := s.Len()
+	for j, i := range dynamic {
+		size := s.Len()
+		if j < len(dynamic)-1 {
+			if size = bytesLeft / len(dynamic); sum > 0 {
+				size = (bytesLeft * int(weights[j])) / sum
+			}
+		}
+		s.fillV1(args[i], size)
+	}
+}
+
+// fillV1 sets the value v, of a type supported by layout 1, from the source.
+// The size is the number of bytes to use for strings and byte slices.
+func (s *Source) fillV1(v reflect.Value, size int) {
+	switch k := v.Kind(); k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(s.readInt(k))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(s.readUint(k))
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(uint32(s.readUint(reflect.Uint32)))))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(s.readUint(reflect.Uint64)))
+	case reflect.Bool:
+		v.SetBool(s.readUint(reflect.Uint8)&0x1 != 0)
+	case reflect.String:
+		if s.allocate(size, 1) {
+			v.SetString(decodeString(s.getBytes(size), s.stringMode(v.Type())))
+		}
+	case reflect.Slice:
+		if s.allocate(size, 1) {
+			v.SetBytes(s.getSlice(size))
+		}
+	}
+}
+
+// supportedV1 reports whether typ was supported in layout 1.
+func supportedV1(typ reflect.Type) bool {
+	switch k := typ.Kind(); {
+	case k == reflect.Uintptr:
+		return false
+	case k <= reflect.Float64, k == reflect.String:
+		return true
+	case k == reflect.Slice:
+		return typ.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// supportedV2 reports whether typ is supported in layout 2.
+func supportedV2(typ reflect.Type) bool {
+	if _, ok := typeDecoders[typ]; ok {
+		return true
+	}
+	switch k := typ.Kind(); {
+	case k <= reflect.Complex128, k == reflect.String:
+		return true
+	case k == reflect.Slice:
+		return fixedSize(typ.Elem().Kind()) > 0
+	}
+	return false
+}
+
+// AddHeader returns the data prefixed with a header recording the current
+// layout version. Inputs with a header can be used as-is, the header is
+// stripped by NewSource.
+func AddHeader(data []byte) []byte {
+	return addHeader(LayoutVersion, data)
+}
+
+func addHeader(version int, data []byte) []byte {
+	return append(append([]byte(headerMagic), byte(version)), data...)
+}
+
+// ParseHeader checks if data starts with a layout header for a known layout
+// version, and if so returns the version, and the data following the header.
+func ParseHeader(data []byte) (version int, body []byte, ok bool) {
+	if !bytes.HasPrefix(data, []byte(headerMagic)) || len(data) <= len(headerMagic) {
+		return 0, data, false
+	}
+	version = int(data[len(headerMagic)])
+	if _, known := layouts[version]; !known {
+		return 0, data, false
+	}
+	return version, data[len(headerMagic)+1:], true
+}
+
+// Decode decodes the arguments for the fuzz function fn from data (which may
+// start with a header), without invoking fn. The returned values exclude the
+// first argument of fn.
+func Decode(fn any, data []byte) ([]reflect.Value, error) {
+	return DecodeVersion(0, fn, data)
+}
+
+// DecodeVersion decodes data according to the given layout version, unless the
+// data has a header, in which case the version in the header is used. A version
+// of 0 means the current version.
+func DecodeVersion(version int, fn any, data []byte) (vals []reflect.Value, err error) {
+	src := NewSource(data)
+	if _, _, ok := ParseHeader(data); !ok && version != 0 {
+		src.version = version
+	}
+	l, ok := layouts[src.version]
+	if !ok {
+		return nil, fmt.Errorf("unknown layout version %d", src.version)
+	}
+	p := planFor(reflect.TypeOf(fn))
+	for i, typ := range p.in[1:] {
+		if !l.supports(typ) {
+			return nil, fmt.Errorf("argument %d: type %v not supported in layout version %d", i+1, typ, src.version)
+		}
+	}
+	src.SetLimits(Limits{})
+	args := make([]reflect.Value, len(p.in))
+	for i := 1; i < len(args); i++ {
+		args[i] = reflect.New(p.in[i]).Elem()
+	}
+	l.decode(src, p, args)
+	return args[1:], nil
+}
+
+// Upgrade converts an input from the given layout version (or the version in
+// its header, if any) to the current layout, for the fuzz function fn.
+// The output has a header.
+//
+// The input is decoded with the old layout, and re-encoded with the current
+// one, unless all layouts since are compatible, in which case only the header
+// is updated.
+func Upgrade(version int, fn any, data []byte) ([]byte, error) {
+	vals, err := DecodeVersion(version, fn, data)
+	if err != nil {
+		return nil, err
+	}
+	if v, body, ok := ParseHeader(data); ok {
+		version, data = v, body
+	} else if version == 0 {
+		version = LayoutVersion
+	}
+	compatible := true
+	for v := version + 1; v <= LayoutVersion; v++ {
+		compatible = compatible && layouts[v].compatible
+	}
+	if compatible {
+		return AddHeader(data), nil
+	}
+	out, err := EncodeValues(fn, vals)
+	if err != nil {
+		return nil, err
+	}
+	return AddHeader(out), nil
+}
@@ -0,0 +1,211 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHeader(t *testing.T) {
+	data := AddHeader([]byte{1, 2, 3})
+	version, body, ok := ParseHeader(data)
+	if !ok || version != LayoutVersion || !bytes.Equal(body, []byte{1, 2, 3}) {
+		t.Fatalf("have %v %x %v", version, body, ok)
+	}
+	// Unknown versions are not recognized as header
+	if _, _, ok := ParseHeader(addHeader(200, []byte{1})); ok {
+		t.Fatal("expected unknown version to be rejected")
+	}
+	// The header is stripped by NewSource
+	var have uint16
+	NewSource(AddHeader([]byte{1, 2})).FillAndCall(func(t *testing.T, a uint16) { have = a }, reflect.ValueOf(new(testing.T)))
+	if have != 0x0102 {
+		t.Fatalf("have %#x", have)
+	}
+}
+
+func TestEncodeRoundtrip(t *testing.T) {
+	fuzzFunc := func(t *testing.T, a uint16, s string, b bool, d []byte, c complex64,
+		e []int32, f float64, g *big.Int, h netip.AddrPort, i time.Time) {
+	}
+	var failed int
+	rnd := rand.New(rand.NewSource(1))
+	randBytes := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+		return b
+	}
+	for i := 0; i < 200; i++ {
+		args := []any{
+			uint16(rnd.Uint32()),
+			string(randBytes(rnd.Intn(100))),
+			rnd.Intn(2) == 1,
+			randBytes(rnd.Intn(300)),
+			complex(rnd.Float32(), rnd.Float32()),
+			make([]int32, rnd.Intn(20)),
+			rnd.NormFloat64(),
+			new(big.Int).SetBytes(randBytes(rnd.Intn(40))),
+			netip.AddrPortFrom(netip.AddrFrom16([16]byte(randBytes(16))), 8080),
+			time.Unix(rnd.Int63n(1<<34), rnd.Int63n(1e9)).UTC(),
+		}
+		data, err := Encode(fuzzFunc, args...)
+		if err != nil {
+			// Not all splits can be expressed with 8-bit weights
+			failed++
+			continue
+		}
+		vals, err := Decode(fuzzFunc, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, v := range vals {
+			have, want := fmt.Sprint(v.Interface()), fmt.Sprint(args[j])
+			if have != want {
+				t.Fatalf("test %d arg %d: have %v want %v", i, j, have, want)
+			}
+		}
+	}
+	if failed > 50 {
+		t.Fatalf("too many failures: %d", failed)
+	}
+	t.Logf("%d unrepresentable inputs", failed)
+}
+
+func TestEncodeStringTypes(t *testing.T) {
+	fuzzFunc := func(t *testing.T, a PrintableString, b UTF8String) {}
+	data, err := Encode(fuzzFunc, PrintableString("a~b"), UTF8String("\u00e9t\u00e9"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals, err := Decode(fuzzFunc, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := fmt.Sprintf("%q %q", vals[0].Interface(), vals[1].Interface()); have != `"a~b" "été"` {
+		t.Fatalf("have %v", have)
+	}
+	if _, err := Encode(fuzzFunc, PrintableString("\n"), UTF8String("")); err == nil {
+		t.Fatal("expected error for non-printable string")
+	}
+}
+
+func TestEncodeMode(t *testing.T) {
+	fuzzFunc := func(t *testing.T, kind uint8, s string) {}
+	data, err := EncodeMode(StringPrintable, fuzzFunc, uint8(1), "magic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := NewSource(data)
+	src.SetStringMode(StringPrintable)
+	var have string
+	src.FillAndCall(func(t *testing.T, kind uint8, s string) { have = s }, reflect.ValueOf(new(testing.T)))
+	if have != "magic" {
+		t.Fatalf("have %q, want \"magic\"", have)
+	}
+	if _, err := EncodeMode(StringPrintable, fuzzFunc, uint8(1), "\n"); err == nil {
+		t.Fatal("expected error for non-printable string")
+	}
+}
+
+func TestFindWeights(t *testing.T) {
+	for i, tc := range []struct {
+		sizes, lens []int
+	}{
+		{[]int{1, 1}, []int{0, 0}},
+		{[]int{1, 1}, []int{10, 0}},
+		{[]int{1, 1, 1, 1}, []int{1, 10, 5, 5}},
+		{[]int{4, 1, 8}, []int{3, 7, 1}},
+		{[]int{1, 1, 1}, []int{100, 3, 200}},
+	} {
+		weights, err := findWeights(tc.sizes, tc.lens)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		var free int
+		for j := range tc.lens {
+			free += tc.lens[j] * tc.sizes[j]
+		}
+		src := NewSource(append(weights, make([]byte, free)...))
+		split := src.Split(tc.sizes...)
+		for j := range tc.lens {
+			n := split.Next()
+			if n != tc.lens[j] {
+				t.Fatalf("test %d: arg %d have %d want %d (weights %v)", i, j, n, tc.lens[j], weights)
+			}
+			src.getBytes(n * tc.sizes[j])
+		}
+	}
+	if _, err := findWeights([]int{1, 1}, []int{1, 100000}); err == nil {
+		t.Fatal("expected error for unrepresentable lengths")
+	}
+}
+
+func TestUpgradeV1(t *testing.T) {
+	fuzzFunc := func(t *testing.T, a uint64, s1, s2 string, b []byte) {}
+	data := append([]byte{0, 0, 0, 0, 0, 0, 0, 1, 1, 10, 5}, "122222222223333344444"...)
+	out, err := Upgrade(1, fuzzFunc, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := AddHeader(data); !bytes.Equal(out, want) {
+		t.Fatalf("have %x want %x", out, want)
+	}
+	// Types not supported in version 1 are rejected
+	if _, err := Upgrade(1, func(t *testing.T, c complex64) {}, data); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecodeV1(t *testing.T) {
+	fuzzFunc := func(t *testing.T, s string, a int16, b []byte, c bool) {}
+	data := []byte{0xff, 0xfe, 1, 1, 3, 'a', 'b', 'c', 'd', 'e', 'f', 'g'}
+	vals, err := DecodeVersion(1, fuzzFunc, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := fmt.Sprintf("%q %v %q %v", vals[0], vals[1], vals[2], vals[3]), `"a" -2 "bcdefg" true`; have != want {
+		t.Fatalf("have %v want %v", have, want)
+	}
+	// Minimum lengths did not exist in layout 1
+	src := NewSource(addHeader(1, data))
+	src.SetMinLens(5)
+	var have string
+	src.FillAndCall(func(t *testing.T, s string, a int16, b []byte, c bool) { have = s }, reflect.ValueOf(new(testing.T)))
+	if have != "a" {
+		t.Fatalf("have %q", have)
+	}
+}
+
+func TestUpgradeReencode(t *testing.T) {
+	// Pretend the current layout is incompatible with layout 1, so inputs are
+	// decoded with the frozen layout 1 decoder, and re-encoded.
+	l := layouts[LayoutVersion]
+	l.compatible = false
+	layouts[LayoutVersion] = l
+	defer func() {
+		l.compatible = true
+		layouts[LayoutVersion] = l
+	}()
+	fuzzFunc := func(t *testing.T, a uint64, s1, s2 string, b []byte) {}
+	data := append([]byte{0, 0, 0, 0, 0, 0, 0, 1, 1, 10, 5}, "122222222223333344444"...)
+	out, err := Upgrade(1, fuzzFunc, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(out, AddHeader(data)) {
+		t.Fatal("input not re-encoded")
+	}
+	want, _ := DecodeVersion(1, fuzzFunc, data)
+	have, err := Decode(fuzzFunc, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%q", have) != fmt.Sprintf("%q", want) {
+		t.Fatalf("have %q want %q", have, want)
+	}
+}
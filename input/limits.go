@@ -0,0 +1,52 @@
+package input
+
+// Limits bounds the resources spent on decoding a single input. A zero value
+// for any of the fields means that there is no limit.
+//
+// Exceeding a limit does not cause an allocation: instead, the affected argument
+// is left zero, and the source is marked as exhausted, causing the input
+// to be rejected.
+type Limits struct {
+	MaxAlloc int // Maximum number of bytes allocated for dynamic arguments, in total
+	MaxLen   int // Maximum length of a single string, slice or map
+	MaxDepth int // Maximum nesting depth of slices and maps
+}
+
+// DefaultLimits are the limits used by new sources.
+var DefaultLimits = Limits{
+	MaxAlloc: 64 << 20,
+	MaxLen:   16 << 20,
+	MaxDepth: 32,
+}
+
+// allocate reserves n elements of elemSize bytes for a dynamic argument. It
+// returns false, and marks the source exhausted, if that would violate the limits.
+func (s *Source) allocate(n, elemSize int) bool {
+	if max := s.limits.MaxLen; max > 0 && n > max {
+		s.exhausted = true
+		return false
+	}
+	if max := s.limits.MaxAlloc; max > 0 && s.allocated+n*elemSize > max {
+		s.exhausted = true
+		return false
+	}
+	s.allocated += n * elemSize
+	return true
+}
+
+// enter increases the nesting depth. It returns false, and marks the source
+// exhausted, if the maximum depth is exceeded. Each successful call to
+// enter must be paired with a call to leave.
+func (s *Source) enter() bool {
+	if max := s.limits.MaxDepth; max > 0 && s.depth >= max {
+		s.exhausted = true
+		return false
+	}
+	s.depth++
+	return true
+}
+
+// leave decreases the nesting depth.
+func (s *Source) leave() {
+	s.depth--
+}
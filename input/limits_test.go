@@ -0,0 +1,64 @@
+package input
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLimitsMaxLen(t *testing.T) {
+	src := NewSource(make([]byte, 100))
+	src.SetLimits(Limits{MaxLen: 10})
+	v := src.fillArg(reflect.TypeOf(""), 10)
+	if v.Len() != 10 || src.IsExhausted() {
+		t.Fatalf("expected success, len %d exhausted %v", v.Len(), src.IsExhausted())
+	}
+	v = src.fillArg(reflect.TypeOf([]byte{}), 11)
+	if v.Len() != 0 || !src.IsExhausted() {
+		t.Fatalf("expected failure, len %d exhausted %v", v.Len(), src.IsExhausted())
+	}
+	if src.Used() != 10 {
+		t.Fatalf("expected no bytes to be consumed, used %d", src.Used())
+	}
+}
+
+func TestLimitsMaxAlloc(t *testing.T) {
+	var have []int
+	fuzzFunc := func(t *testing.T, a, b, c []byte) {
+		have = []int{len(a), len(b), len(c)}
+	}
+	input := append([]byte{1, 1, 1}, make([]byte, 30)...)
+	src := NewSource(input)
+	src.SetLimits(Limits{MaxAlloc: 25})
+	src.FillAndCall(fuzzFunc, reflect.ValueOf(new(testing.T)))
+	if want := []int{10, 10, 0}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("have %v want %v", have, want)
+	}
+	if !src.IsExhausted() {
+		t.Fatal("expected exhausted")
+	}
+	// Without limits
+	src = NewSource(input)
+	src.SetLimits(Limits{})
+	src.FillAndCall(fuzzFunc, reflect.ValueOf(new(testing.T)))
+	if want := []int{10, 10, 10}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("have %v want %v", have, want)
+	}
+	if src.IsExhausted() {
+		t.Fatal("expected not exhausted")
+	}
+}
+
+func TestLimitsMaxDepth(t *testing.T) {
+	src := NewSource(make([]byte, 10))
+	src.SetLimits(Limits{MaxDepth: 1})
+	if !src.enter() {
+		t.Fatal("expected enter to succeed")
+	}
+	if src.enter() || !src.IsExhausted() {
+		t.Fatal("expected enter to fail")
+	}
+	src.leave()
+	if v := src.fillArg(reflect.TypeOf([]byte{}), 5); v.Len() != 5 {
+		t.Fatalf("have len %d want 5", v.Len())
+	}
+}
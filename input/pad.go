@@ -0,0 +1,51 @@
+package input
+
+// PadPolicy determines what happens when the fuzz target needs more input than
+// is available.
+type PadPolicy int
+
+const (
+	// PadZero pads the input with zeros. The target is invoked, but the
+	// input is considered exhausted.
+	PadZero PadPolicy = iota
+	// PadSkip marks the input as exhausted, and the target is not invoked.
+	PadSkip
+	// PadWrap wraps around, and reuses the input from the start. The input
+	// is not considered exhausted.
+	PadWrap
+)
+
+// SetPadPolicy sets the policy for when the input is exhausted.
+func (s *Source) SetPadPolicy(p PadPolicy) {
+	s.pad = p
+}
+
+// PadPolicy returns the policy for when the input is exhausted.
+func (s *Source) PadPolicy() PadPolicy {
+	return s.pad
+}
+
+// readPadded fills b from the source. If there is not enough input, the
+// remainder is padded according to the padding policy.
+func (s *Source) readPadded(b []byte) {
+	var n int
+	if s.i < int64(len(s.s)) {
+		n = copy(b, s.s[s.i:])
+		s.i += int64(n)
+	}
+	if n == len(b) {
+		return
+	}
+	s.padded += len(b) - n
+	if s.pad != PadWrap {
+		s.exhausted = true // b is already zeroed
+		return
+	}
+	if len(s.s) == 0 {
+		return
+	}
+	for i := n; i < len(b); i++ {
+		b[i] = s.s[s.wrapped%len(s.s)]
+		s.wrapped++
+	}
+}
@@ -0,0 +1,5 @@
+//go:build gofuzz_pad_skip
+
+package input
+
+const defaultPadPolicy = PadSkip
@@ -0,0 +1,55 @@
+package input
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPadPolicies(t *testing.T) {
+	for i, tc := range []struct {
+		policy    PadPolicy
+		want      string
+		exhausted bool
+	}{
+		{PadZero, "0x102 0x3000000 \"\"", true},
+		{PadSkip, "not invoked", true},
+		{PadWrap, "0x102 0x3010203 \"\"", false},
+	} {
+		have := "not invoked"
+		fuzzFunc := func(t *testing.T, a uint16, b uint32, c string) {
+			have = fmt.Sprintf("%#x %#x %q", a, b, c)
+		}
+		src := NewSource([]byte{1, 2, 3})
+		src.SetPadPolicy(tc.policy)
+		ok := src.FillAndCall(fuzzFunc, reflect.ValueOf(new(testing.T)))
+		if have != tc.want {
+			t.Errorf("test %d: have %v want %v", i, have, tc.want)
+		}
+		if ok != (tc.policy != PadSkip) {
+			t.Errorf("test %d: wrong return value %v", i, ok)
+		}
+		if src.IsExhausted() != tc.exhausted {
+			t.Errorf("test %d: have exhausted %v want %v", i, src.IsExhausted(), tc.exhausted)
+		}
+	}
+}
+
+func TestPadWrapEmpty(t *testing.T) {
+	src := NewSource(nil)
+	src.SetPadPolicy(PadWrap)
+	if v := src.ConsumeUint32(); v != 0 {
+		t.Fatalf("have %d want 0", v)
+	}
+}
+
+func TestPadWrapLimits(t *testing.T) {
+	// Exceeding the limits marks the source exhausted, regardless of policy
+	src := NewSource([]byte{1, 2, 3})
+	src.SetPadPolicy(PadWrap)
+	src.SetLimits(Limits{MaxLen: 1})
+	src.ConsumeString(2)
+	if !src.IsExhausted() {
+		t.Fatal("expected exhausted")
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !gofuzz_pad_skip && !gofuzz_pad_wrap
+
+package input
+
+const defaultPadPolicy = PadZero
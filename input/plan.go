@@ -0,0 +1,87 @@
+package input
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// plan is the decoding plan for a fuzz function signature. It is built once
+// per function type, and reused for every input.
+type plan struct {
+	in      []reflect.Type // argument types
+	fixed   []int          // indices of fixed-size arguments, in order
+	dynamic []int          // indices of dynamic-sized arguments, in order
+
+	elemSizes []int     // element sizes of the dynamic-sized arguments
+	frames    sync.Pool // reusable argument frames
+}
+
+// frame holds the storage for the arguments of one invocation.
+type frame struct {
+	vals reflect.Value   // struct with one field per argument (except the first)
+	args []reflect.Value // the arguments, args[i] referencing a field in vals
+}
+
+// plans caches the decoding plans, keyed by function type.
+var plans sync.Map
+
+// planFor returns the (cached) decoding plan for the given function type.
+func planFor(typ reflect.Type) *plan {
+	if p, ok := plans.Load(typ); ok {
+		return p.(*plan)
+	}
+	if typ.Kind() != reflect.Func {
+		panic(fmt.Sprintf("wrong type: %v", typ))
+	}
+	p := &plan{in: make([]reflect.Type, typ.NumIn())}
+	var fields []reflect.StructField
+	for i := range p.in {
+		p.in[i] = typ.In(i)
+		if i == 0 {
+			continue // *testing.T
+		}
+		fields = append(fields, reflect.StructField{Name: "A" + strconv.Itoa(i), Type: p.in[i]})
+		if isFixed(p.in[i]) {
+			p.fixed = append(p.fixed, i)
+		} else { // dynamic or panic later
+			p.dynamic = append(p.dynamic, i)
+			p.elemSizes = append(p.elemSizes, elemSize(p.in[i]))
+		}
+	}
+	frameType := reflect.StructOf(fields)
+	p.frames.New = func() any {
+		fr := &frame{
+			vals: reflect.New(frameType).Elem(),
+			args: make([]reflect.Value, len(p.in)),
+		}
+		for i := 1; i < len(p.in); i++ {
+			fr.args[i] = fr.vals.Field(i - 1)
+		}
+		return fr
+	}
+	actual, _ := plans.LoadOrStore(typ, p)
+	return actual.(*plan)
+}
+
+// isFixed returns whether typ is decoded along with the fixed-size arguments.
+func isFixed(typ reflect.Type) bool {
+	if d, ok := typeDecoders[typ]; ok {
+		return !d.dynamic
+	}
+	return typ.Kind() <= reflect.Complex128
+}
+
+// getFrame returns an argument frame from the pool.
+func (p *plan) getFrame() *frame {
+	return p.frames.Get().(*frame)
+}
+
+// putFrame returns the frame to the pool. The arguments are zeroed first, so
+// no references to the input are retained.
+func (p *plan) putFrame(fr *frame) {
+	fr.args[0] = reflect.Value{}
+	fr.vals.SetZero()
+	p.frames.Put(fr)
+}
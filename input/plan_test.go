@@ -0,0 +1,41 @@
+package input
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanCache(t *testing.T) {
+	f1 := func(t *testing.T, a uint8, b []byte, c int64, d string) {}
+	f2 := func(t *testing.T, x uint8, y []byte, z int64, w string) {}
+	p := planFor(reflect.TypeOf(f1))
+	if p2 := planFor(reflect.TypeOf(f2)); p2 != p {
+		t.Fatal("expected cached plan for identical signature")
+	}
+	if want := []int{1, 3}; !reflect.DeepEqual(p.fixed, want) {
+		t.Errorf("fixed: have %v want %v", p.fixed, want)
+	}
+	if want := []int{2, 4}; !reflect.DeepEqual(p.dynamic, want) {
+		t.Errorf("dynamic: have %v want %v", p.dynamic, want)
+	}
+}
+
+func TestPlanFrameReuse(t *testing.T) {
+	var seen [][]byte
+	fuzzFunc := func(t *testing.T, a uint8, b []byte) {
+		seen = append(seen, b)
+	}
+	arg0 := reflect.ValueOf(new(testing.T))
+	NewSource([]byte{1, 0, 2, 3}).FillAndCall(fuzzFunc, arg0)
+	NewSource([]byte{4, 0, 5}).FillAndCall(fuzzFunc, arg0)
+	if string(seen[0]) != "\x02\x03" || string(seen[1]) != "\x05" {
+		t.Fatalf("wrong args: %q", seen)
+	}
+	// Returned frames must not keep references to the input
+	p := planFor(reflect.TypeOf(fuzzFunc))
+	fr := p.getFrame()
+	defer p.putFrame(fr)
+	if !fr.vals.IsZero() {
+		t.Fatalf("frame not zeroed: %v", fr.vals)
+	}
+}
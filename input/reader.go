@@ -13,10 +13,46 @@ type Source struct {
 	s         []byte
 	i         int64 // current reading index
 	exhausted bool
+	strMode   StringMode // decoding mode for plain string arguments
+	limits    Limits     // resource limits for decoding
+	allocated int        // bytes allocated for dynamic arguments so far
+	depth     int        // current nesting depth
+	padded    int        // number of bytes requested beyond the end of the input
+	minLens   []int      // minimum lengths of dynamic-sized arguments
+	pad       PadPolicy  // what to do when the input is exhausted
+	wrapped   int        // number of bytes reused from the start, with PadWrap
+	version   int        // layout version of the input
+
+	debug   bool          // copy byte slices and check for aliasing (gofuzz_debug)
+	aliases []aliasRecord // byte slices handed out in debug mode
 }
 
+// NewSource creates a source from the given data. If the data starts with a
+// layout header (see AddHeader), the header is stripped, and the data is decoded
+// according to the layout version in the header.
 func NewSource(data []byte) *Source {
-	return &Source{data, 0, false}
+	version := LayoutVersion
+	if v, body, ok := ParseHeader(data); ok {
+		version, data = v, body
+	}
+	return &Source{s: data, strMode: defaultStringMode, limits: DefaultLimits, pad: defaultPadPolicy,
+		version: version, debug: debugAliasing}
+}
+
+// Version returns the layout version the source is decoded with.
+func (s *Source) Version() int {
+	return s.version
+}
+
+// SetLimits sets the resource limits used when decoding arguments.
+func (s *Source) SetLimits(l Limits) {
+	s.limits = l
+}
+
+// SetStringMode sets the mode used to decode string arguments. Arguments of
+// type UTF8String or PrintableString always use their own mode.
+func (s *Source) SetStringMode(mode StringMode) {
+	s.strMode = mode
 }
 
 // IsExhausted returns true if we tried to read more data than this source
@@ -53,15 +89,28 @@ func (s *Source) Read(b []byte) (n int, err error) {
 }
 
 // getBytes returns a slice of size bytes, as a direct reference if possible.
+// Only if the source is exhausted, a new padded slice is allocated.
 func (s *Source) getBytes(size int) []byte {
-	if end := int(s.i) + size; end < len(s.s) { // Fast-path, no-copy deliver
+	if end := int(s.i) + size; end <= len(s.s) { // Fast-path, no-copy deliver
 		pos := s.i
-		s.i += int64(size)
-		return s.s[pos:end]
+		s.i = int64(end)
+		return s.s[pos:end:end]
 	}
 	// Slow path
 	buf := make([]byte, size)
-	s.Read(buf)
+	s.readPadded(buf)
+	return buf
+}
+
+// readFixed reads size (max 8) bytes into a fixed-size array, padded if
+// the source is exhausted. It never allocates.
+func (s *Source) readFixed(size int) (buf [8]byte) {
+	if end := int(s.i) + size; end <= len(s.s) {
+		copy(buf[:], s.s[s.i:end])
+		s.i = int64(end)
+		return buf
+	}
+	s.readPadded(buf[:size])
 	return buf
 }
 
@@ -69,13 +118,17 @@ func (s *Source) getBytes(size int) []byte {
 func (s *Source) readInt(num reflect.Kind) int64 {
 	switch num {
 	case reflect.Int8:
-		return int64(int8(s.getBytes(1)[0]))
+		buf := s.readFixed(1)
+		return int64(int8(buf[0]))
 	case reflect.Int16:
-		return int64(int16(binary.BigEndian.Uint16(s.getBytes(2))))
+		buf := s.readFixed(2)
+		return int64(int16(binary.BigEndian.Uint16(buf[:])))
 	case reflect.Int32:
-		return int64(int32(binary.BigEndian.Uint32(s.getBytes(4))))
+		buf := s.readFixed(4)
+		return int64(int32(binary.BigEndian.Uint32(buf[:])))
 	case reflect.Int64, reflect.Int:
-		return int64(binary.BigEndian.Uint64(s.getBytes(8)))
+		buf := s.readFixed(8)
+		return int64(binary.BigEndian.Uint64(buf[:]))
 	}
 	panic(fmt.Sprintf("unsupported type: %v", num))
 }
@@ -84,13 +137,28 @@ func (s *Source) readInt(num reflect.Kind) int64 {
 func (s *Source) readUint(num reflect.Kind) uint64 {
 	switch num {
 	case reflect.Uint8:
-		return uint64(uint8(s.getBytes(1)[0]))
+		buf := s.readFixed(1)
+		return uint64(buf[0])
 	case reflect.Uint16:
-		return uint64(binary.BigEndian.Uint16(s.getBytes(2)))
+		buf := s.readFixed(2)
+		return uint64(binary.BigEndian.Uint16(buf[:]))
 	case reflect.Uint32:
-		return uint64(binary.BigEndian.Uint32(s.getBytes(4)))
-	case reflect.Uint, reflect.Uint64:
-		return binary.BigEndian.Uint64(s.getBytes(8))
+		buf := s.readFixed(4)
+		return uint64(binary.BigEndian.Uint32(buf[:]))
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		buf := s.readFixed(8)
+		return binary.BigEndian.Uint64(buf[:])
+	}
+	panic(fmt.Sprintf("unsupported type: %v", num))
+}
+
+// readFloat reads a floating point number from the source
+func (s *Source) readFloat(num reflect.Kind) float64 {
+	switch num {
+	case reflect.Float32:
+		return float64(math.Float32frombits(uint32(s.readUint(reflect.Uint32))))
+	case reflect.Float64:
+		return math.Float64frombits(s.readUint(reflect.Uint64))
 	}
 	panic(fmt.Sprintf("unsupported type: %v", num))
 }
@@ -98,76 +166,90 @@ func (s *Source) readUint(num reflect.Kind) uint64 {
 // FillAndCall fills the argument for the given ff (which is supposed to be a function),
 // and then invokes the function.
 // It returns 'true' if the function was invoked. A return-value of false means
-// that the method was not invoked: probably because of insufficient input.
+// that the method was not invoked, because the input was insufficient and the
+// padding policy is PadSkip.
 func (s *Source) FillAndCall(ff any, arg0 reflect.Value) (ok bool) {
 	fn := reflect.ValueOf(ff)
-	method := fn.Type()
-	if method.Kind() != reflect.Func {
-		panic(fmt.Sprintf("wrong type: %T", ff))
-	}
-	args := make([]reflect.Value, method.NumIn())
+	p := planFor(fn.Type())
+	fr := p.getFrame()
+	defer p.putFrame(fr)
+	args := fr.args
 	args[0] = arg0
-	var dynamic []int
+	layouts[s.version].decode(s, p, args)
+	return s.Invoke(func() { fn.Call(args) })
+}
+
+// decodeArgs fills the arguments (except the first) according to the current
+// layout.
+func (s *Source) decodeArgs(p *plan, args []reflect.Value) {
 	// Fill all fixed-size arguments first, then dynamic-sized fields.
-	for i := 1; i < method.NumIn(); i++ {
-		v := method.In(i)
-		if v.Kind() <= reflect.Float64 { // fixed-size
-			args[i] = s.fillArg(v, 0)
-		} else { // dynamic or panic later
-			dynamic = append(dynamic, i)
-		}
+	for _, i := range p.fixed {
+		s.fill(args[i], 0)
 	}
 	// Second loop to fill dynamic-sized stuff
-	// For filling the dynamic fields.
-	// If we have only one field, it should get all the remaining input.
-	// If we have N, then,
-	// 1. Read N bytes [b1, b2, b3 .. bn] .
-	// 2. Let the relative weights of b determine how much of the
-	//    remaining input that field n gets
-	weights := s.getBytes(len(dynamic))
-	sum := 0
-	for _, v := range weights {
-		sum += int(v)
-	}
-	bytesLeft := s.Len()
-	for i, argNum := range dynamic {
-		if i == len(dynamic)-1 { // last element, it get's all that if left
-			args[argNum] = s.fillArg(method.In(argNum), s.Len())
-			break
-		}
-		var argSize = bytesLeft / len(dynamic)
-		if sum > 0 {
-			argSize = (bytesLeft * int(weights[i])) / sum
-		}
-		args[argNum] = s.fillArg(method.In(argNum), argSize)
+	split := s.Split(p.elemSizes...)
+	for _, argNum := range p.dynamic {
+		s.fill(args[argNum], split.Next())
 	}
-	fn.Call(args)
-	return true
 }
 
+// fillArg returns a new value of type v, filled from the source.
 func (s *Source) fillArg(v reflect.Type, max int) reflect.Value {
 	newElem := reflect.New(v).Elem()
+	s.fill(newElem, max)
+	return newElem
+}
+
+// fill sets the (settable) value newElem from the source. The max parameter
+// is the number of elements to use for dynamic-sized types.
+func (s *Source) fill(newElem reflect.Value, max int) {
+	v := newElem.Type()
+	if d, ok := typeDecoders[v]; ok {
+		d.fill(s, newElem, max)
+		return
+	}
 	switch k := v.Kind(); k {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		newElem.SetInt(s.readInt(k))
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		newElem.SetUint(s.readUint(k))
-	case reflect.Float32:
-		newElem.Set(reflect.ValueOf(math.Float32frombits(uint32(s.readUint(reflect.Uint32)))))
-	case reflect.Float64:
-		newElem.Set(reflect.ValueOf(math.Float64frombits(s.readUint(reflect.Uint64))))
+	case reflect.Float32, reflect.Float64:
+		newElem.SetFloat(s.readFloat(k))
+	case reflect.Complex64:
+		re := s.readFloat(reflect.Float32)
+		im := s.readFloat(reflect.Float32)
+		newElem.SetComplex(complex(re, im))
+	case reflect.Complex128:
+		re := s.readFloat(reflect.Float64)
+		im := s.readFloat(reflect.Float64)
+		newElem.SetComplex(complex(re, im))
 	case reflect.Bool:
-		newElem.Set(reflect.ValueOf(s.readUint(reflect.Uint8)&0x1 != 0))
+		newElem.SetBool(s.readUint(reflect.Uint8)&0x1 != 0)
 	case reflect.String:
-		newElem.SetString(string(s.getBytes(max)))
+		if s.allocate(max, 1) {
+			newElem.SetString(decodeString(s.getBytes(max), s.stringMode(v)))
+		}
 	case reflect.Slice:
+		size := fixedSize(v.Elem().Kind())
+		if size == 0 {
+			panic(fmt.Sprintf("unsupported type: %v", v))
+		}
+		if !s.enter() {
+			break
+		}
+		defer s.leave()
+		if !s.allocate(max, size) {
+			break
+		}
 		if v.Elem().Kind() == reflect.Uint8 { // []byte
-			newElem.SetBytes(s.getBytes(max))
-		} else {
-			panic(fmt.Sprintf("unsupported type: %T", newElem.Kind))
+			newElem.SetBytes(s.getSlice(max))
+			break
+		}
+		newElem.Set(reflect.MakeSlice(v, max, max))
+		for i := 0; i < max; i++ {
+			s.fill(newElem.Index(i), 0)
 		}
 	default:
-		panic(fmt.Sprintf("unsupported type: %T", newElem.Kind))
+		panic(fmt.Sprintf("unsupported type: %v", v))
 	}
-	return newElem
 }
@@ -210,3 +210,60 @@ func TestReader(t *testing.T) {
 		}
 	}
 }
+
+type (
+	namedInt     int16
+	namedUint    uint32
+	namedUintptr uintptr
+	namedFloat32 float32
+	namedFloat64 float64
+	namedCplx64  complex64
+	namedCplx128 complex128
+	namedBool    bool
+	namedString  string
+	namedBytes   []byte
+)
+
+func TestScalarKinds(t *testing.T) {
+	data := []byte{0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	for i, tc := range []struct {
+		input any
+		want  string
+	}{
+		{int8(0), "63"},
+		{int16(0), "16368"},
+		{int32(0), "1072693248"},
+		{int64(0), "4607182418800017408"},
+		{int(0), "4607182418800017408"},
+		{uint8(0), "63"},
+		{uint16(0), "16368"},
+		{uint32(0), "1072693248"},
+		{uint64(0), "4607182418800017408"},
+		{uint(0), "4607182418800017408"},
+		{uintptr(0), "4607182418800017408"},
+		{float32(0), "1.875"},
+		{float64(0), "1"},
+		{complex64(0), "(1.875+0i)"},
+		{complex128(0), "(1+2i)"},
+		{false, "true"},
+		{namedInt(0), "16368"},
+		{namedUint(0), "1072693248"},
+		{namedUintptr(0), "4607182418800017408"},
+		{namedFloat32(0), "1.875"},
+		{namedFloat64(0), "1"},
+		{namedCplx64(0), "(1.875+0i)"},
+		{namedCplx128(0), "(1+2i)"},
+		{namedBool(false), "true"},
+		{namedString(""), "?\xf0\x00\x00"},
+		{namedBytes(nil), "[63 240 0 0]"},
+	} {
+		typ := reflect.TypeOf(tc.input)
+		v := NewSource(data).fillArg(typ, 4)
+		if v.Type() != typ {
+			t.Errorf("test %d: have type %v want %v", i, v.Type(), typ)
+		}
+		if have := fmt.Sprint(v.Interface()); have != tc.want {
+			t.Errorf("test %d (%v): have %q want %q", i, typ, have, tc.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package input
+
+import "reflect"
+
+// fixedSize returns the number of input bytes used for a value of the given
+// kind, or 0 if it is not a fixed-size kind.
+func fixedSize(k reflect.Kind) int {
+	switch k {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr,
+		reflect.Float64, reflect.Complex64:
+		return 8
+	case reflect.Complex128:
+		return 16
+	}
+	return 0
+}
+
+// elemSize returns the number of input bytes per element of a dynamic-sized
+// type. Unsupported types report 1, and panic when filled.
+func elemSize(typ reflect.Type) int {
+	if typ.Kind() == reflect.Slice {
+		if size := fixedSize(typ.Elem().Kind()); size > 0 {
+			return size
+		}
+	}
+	return 1
+}
+
+// SetMinLens sets the minimum number of elements for each of the dynamic-sized
+// arguments (strings and slices), in argument order. Missing values are 0.
+func (s *Source) SetMinLens(lens ...int) {
+	s.minLens = lens
+}
+
+// Splitter divides the remaining input between a number of dynamic-sized
+// arguments, in units of their element size.
+//
+// If there is only one argument, it gets all the remaining input.
+// If there are N, then,
+//  1. Read N bytes [b1, b2, b3 .. bn] .
+//  2. Each argument is given its minimum number of elements. Then, let the
+//     relative weights of b determine how much of the remaining input that
+//     argument n gets, rounded down to whole elements. With all weights zero,
+//     the input is distributed evenly.
+//  3. The last argument gets as many whole elements as are left. Any trailing
+//     bytes which do not make up a whole element are skipped, before the last
+//     argument.
+//
+// Thus, as long as the input suffices for the minimum lengths, all of it is
+// consumed.
+type Splitter struct {
+	s         *Source
+	elemSizes []int
+	weights   []byte
+	sum       int
+	free      int // bytes to distribute by weight, after minimum lengths
+	skipped   int // bytes skipped before the last argument
+	i         int
+}
+
+// Split prepares the filling of dynamic-sized arguments with the given
+// element sizes.
+func (s *Source) Split(elemSizes ...int) Splitter {
+	weights := s.getBytes(len(elemSizes))
+	sum := 0
+	for _, v := range weights {
+		sum += int(v)
+	}
+	free := s.Len()
+	for i, size := range elemSizes {
+		free -= s.minLen(i) * size
+	}
+	return Splitter{s: s, elemSizes: elemSizes, weights: weights, sum: sum, free: max(free, 0)}
+}
+
+// minLen returns the minimum number of elements for dynamic argument i.
+func (s *Source) minLen(i int) int {
+	if i < len(s.minLens) {
+		return s.minLens[i]
+	}
+	return 0
+}
+
+// Next returns the number of elements of the next dynamic-sized argument.
+func (sp *Splitter) Next() int {
+	i := sp.i
+	sp.i++
+	if i >= len(sp.elemSizes) {
+		return 0
+	}
+	size, least := sp.elemSizes[i], sp.s.minLen(i)
+	if i == len(sp.elemSizes)-1 { // last element, it get's all that if left
+		left := sp.s.Len()
+		if sp.skipped = left % size; sp.skipped > 0 {
+			sp.s.getBytes(sp.skipped)
+		}
+		return max(left/size, least)
+	}
+	var share int
+	if sp.sum == 0 {
+		share = sp.free / len(sp.elemSizes)
+	} else {
+		share = (sp.free * int(sp.weights[i])) / sp.sum
+	}
+	return least + share/size
+}
@@ -0,0 +1,89 @@
+package input
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+func TestTypedSlices(t *testing.T) {
+	var have string
+	fuzzFunc := func(t *testing.T, a []uint16, b []bool, c string) {
+		have = fmt.Sprint(a, b, c)
+	}
+	input := []byte{
+		2, 1, 1, // weights, 12 bytes to distribute
+		0, 1, 0, 2, 0, 3, // 12*2/4 = 6 bytes for 'a': 3 elements
+		0, 1, 0xff, // 12*1/4 = 3 bytes for 'b'
+		'x', 'y', 'z', // remainder for 'c'
+	}
+	src := NewSource(input)
+	src.FillAndCall(fuzzFunc, reflect.ValueOf(new(testing.T)))
+	if want := "[1 2 3] [false true true]xyz"; have != want {
+		t.Fatalf("have %q want %q", have, want)
+	}
+	if src.Len() != 0 || src.IsExhausted() {
+		t.Fatalf("expected all input consumed, %d left", src.Len())
+	}
+}
+
+func TestSplitRaggedLast(t *testing.T) {
+	var have string
+	fuzzFunc := func(t *testing.T, a []byte, b []uint32) {
+		have = fmt.Sprint(a, b)
+	}
+	// free = 9: a gets 0 bytes, b gets 2 elements, one byte skipped
+	src := NewSource([]byte{0, 1, 0xff, 0, 0, 0, 1, 0, 0, 0, 2})
+	src.FillAndCall(fuzzFunc, reflect.ValueOf(new(testing.T)))
+	if want := "[] [1 2]"; have != want {
+		t.Fatalf("have %q want %q", have, want)
+	}
+	if src.Len() != 0 {
+		t.Fatalf("expected all input consumed, %d left", src.Len())
+	}
+}
+
+func TestSplitMinLens(t *testing.T) {
+	var have string
+	fuzzFunc := func(t *testing.T, a string, b []uint16, c []byte) {
+		have = fmt.Sprint(a, "|", b, "|", c)
+	}
+	src := NewSource(append([]byte{1, 0, 0}, "aaabbbbc"...))
+	src.SetMinLens(1, 2, 1)
+	src.FillAndCall(fuzzFunc, reflect.ValueOf(new(testing.T)))
+	// free = 8 - (1+4+1) = 2, 'a' gets it all (weight 1 of 1)
+	if want := "aaa|[25186 25186]|[99]"; have != want {
+		t.Fatalf("have %q want %q", have, want)
+	}
+}
+
+// TestSplitConsumesAll checks that, as long as the input is large enough for
+// the minimum lengths, the dynamic-sized arguments consume all of it.
+func TestSplitConsumesAll(t *testing.T) {
+	type args struct {
+		fn      any
+		minLens []int
+		minSize int // weights + minimum lengths
+	}
+	for i, tc := range []args{
+		{func(t *testing.T, a string) {}, nil, 1},
+		{func(t *testing.T, a, b []byte, c string) {}, nil, 3},
+		{func(t *testing.T, a []uint32, b []uint64) {}, nil, 2},
+		{func(t *testing.T, a []uint64, b []byte, c []complex128) {}, nil, 3},
+		{func(t *testing.T, a []int16, b string, c []float32) {}, []int{3, 1, 2}, 3 + 6 + 1 + 8},
+	} {
+		prop := func(data []byte) bool {
+			if len(data) < tc.minSize {
+				return true
+			}
+			src := NewSource(data)
+			src.SetMinLens(tc.minLens...)
+			src.FillAndCall(tc.fn, reflect.ValueOf(new(testing.T)))
+			return src.Len() == 0 && !src.IsExhausted()
+		}
+		if err := quick.Check(prop, &quick.Config{MaxCount: 1000}); err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package input
+
+import (
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// StringMode determines how the raw input bytes are turned into a string.
+//
+// All modes map the input byte-by-byte (or rune-by-rune) in a fixed manner, so
+// the same input always decodes into the same string, and corpus files remain
+// valid across builds using the same mode.
+type StringMode int
+
+const (
+	// StringRaw uses the input bytes as-is.
+	StringRaw StringMode = iota
+	// StringUTF8 keeps all valid UTF-8 sequences, and replaces each byte which
+	// is not part of a valid sequence with the rune of the same value
+	// (i.e. it interprets it as Latin-1).
+	StringUTF8
+	// StringPrintable maps each byte onto the printable ASCII range 0x20-0x7e.
+	StringPrintable
+)
+
+// UTF8String can be used as a fuzz argument type to receive a string which is
+// always valid UTF-8, regardless of the string mode of the Source.
+type UTF8String string
+
+// PrintableString can be used as a fuzz argument type to receive a string which
+// consists of printable ASCII characters only, regardless of the string mode of
+// the Source.
+type PrintableString string
+
+var (
+	utf8StringType      = reflect.TypeOf(UTF8String(""))
+	printableStringType = reflect.TypeOf(PrintableString(""))
+)
+
+// stringMode returns the mode to use for decoding a string of type typ.
+func (s *Source) stringMode(typ reflect.Type) StringMode {
+	switch typ {
+	case utf8StringType:
+		return StringUTF8
+	case printableStringType:
+		return StringPrintable
+	}
+	return s.strMode
+}
+
+// decodeString converts data into a string, according to the given mode.
+func decodeString(data []byte, mode StringMode) string {
+	switch mode {
+	case StringUTF8:
+		if utf8.Valid(data) {
+			return string(data)
+		}
+		var sb strings.Builder
+		sb.Grow(len(data) + len(data)/2)
+		for i := 0; i < len(data); {
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError && size <= 1 {
+				r, size = rune(data[i]), 1
+			}
+			sb.WriteRune(r)
+			i += size
+		}
+		return sb.String()
+	case StringPrintable:
+		buf := make([]byte, len(data))
+		for i, b := range data {
+			buf[i] = ' ' + b%('~'-' '+1)
+		}
+		return string(buf)
+	}
+	return string(data)
+}
+
+// EncodeString returns the input bytes which decode into s in the given mode,
+// and whether such input exists. In StringPrintable mode, s must consist of
+// printable ASCII characters only, and in StringUTF8 mode it must be valid
+// UTF-8.
+func EncodeString(s string, mode StringMode) ([]byte, bool) {
+	switch mode {
+	case StringUTF8:
+		if !utf8.ValidString(s) {
+			return nil, false
+		}
+	case StringPrintable:
+		buf := make([]byte, len(s))
+		for i := 0; i < len(s); i++ {
+			if s[i] < ' ' || s[i] > '~' {
+				return nil, false
+			}
+			buf[i] = s[i] - ' '
+		}
+		return buf, true
+	}
+	return []byte(s), true
+}
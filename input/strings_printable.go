@@ -0,0 +1,5 @@
+//go:build gofuzz_strings_printable && !gofuzz_strings_utf8
+
+package input
+
+const defaultStringMode = StringPrintable
@@ -0,0 +1,5 @@
+//go:build !gofuzz_strings_utf8 && !gofuzz_strings_printable
+
+package input
+
+const defaultStringMode = StringRaw
@@ -0,0 +1,99 @@
+package input
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDecodeString(t *testing.T) {
+	for i, tc := range []struct {
+		input []byte
+		mode  StringMode
+		want  string
+	}{
+		{[]byte("foo\xff"), StringRaw, "foo\xff"},
+		{[]byte("foo"), StringUTF8, "foo"},
+		{[]byte("bär"), StringUTF8, "bär"},
+		{[]byte("foo\xff"), StringUTF8, "fooÿ"},
+		{[]byte("\xc3("), StringUTF8, "Ã("},
+		{[]byte("\xef\xbf\xbd"), StringUTF8, "�"},
+		{[]byte{0x00, 0x1f, 0x20, 0x7e, 0x7f, 0xff}, StringPrintable, " ?@?@a"},
+	} {
+		have := decodeString(tc.input, tc.mode)
+		if have != tc.want {
+			t.Errorf("test %d: have %q want %q", i, have, tc.want)
+		}
+	}
+}
+
+func TestEncodeString(t *testing.T) {
+	for i, tc := range []struct {
+		s    string
+		mode StringMode
+		ok   bool
+	}{
+		{"foo\xff", StringRaw, true},
+		{"bär", StringUTF8, true},
+		{"foo\xff", StringUTF8, false},
+		{"GET / HTTP/1.1", StringPrintable, true},
+		{"line\n", StringPrintable, false},
+	} {
+		enc, ok := EncodeString(tc.s, tc.mode)
+		if ok != tc.ok {
+			t.Errorf("test %d: have ok=%v want %v", i, ok, tc.ok)
+			continue
+		}
+		if ok && decodeString(enc, tc.mode) != tc.s {
+			t.Errorf("test %d: %q decodes into %q, want %q", i, enc, decodeString(enc, tc.mode), tc.s)
+		}
+	}
+}
+
+func TestStringModes(t *testing.T) {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	for _, mode := range []StringMode{StringUTF8, StringPrintable} {
+		have := decodeString(data, mode)
+		if !utf8.ValidString(have) {
+			t.Errorf("mode %d: invalid utf8 %q", mode, have)
+		}
+		if mode == StringPrintable {
+			for _, r := range have {
+				if r < ' ' || r > '~' {
+					t.Fatalf("mode %d: unprintable char %q", mode, r)
+				}
+			}
+		}
+		// Decoding must be deterministic
+		if again := decodeString(data, mode); again != have {
+			t.Errorf("mode %d: non-deterministic output", mode)
+		}
+	}
+}
+
+func TestStringArgTypes(t *testing.T) {
+	var have string
+	fuzzFunc := func(t *testing.T, a string, b UTF8String, c PrintableString) {
+		have = fmt.Sprintf("%q|%q|%q", a, b, c)
+	}
+	input := append([]byte{1, 1, 1}, "a\xff\x00b\xff\x00c\xff\x00"...)
+	src := NewSource(input)
+	src.SetStringMode(StringRaw)
+	src.FillAndCall(fuzzFunc, reflect.ValueOf(new(testing.T)))
+	want := `"a\xff\x00"|"bÿ\x00"|"$a "`
+	if have != want {
+		t.Fatalf("have %s want %s", have, want)
+	}
+	// Plain strings follow the source mode
+	src = NewSource(input)
+	src.SetStringMode(StringPrintable)
+	src.FillAndCall(fuzzFunc, reflect.ValueOf(new(testing.T)))
+	want = `"\"a "|"bÿ\x00"|"$a "`
+	if have != want {
+		t.Fatalf("have %s want %s", have, want)
+	}
+}
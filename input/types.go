@@ -0,0 +1,111 @@
+package input
+
+import (
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// typeDecoder decodes values of a specific type, which is not handled by the
+// generic kind-based decoding.
+//
+// Fixed types are decoded along with the fixed-size arguments; they may
+// use a variable amount of input, but it is determined by the input itself
+// (e.g. by a length prefix). Dynamic types are decoded from a share of the
+// remaining input, the same as strings.
+type typeDecoder struct {
+	dynamic bool
+	fill    func(s *Source, v reflect.Value, max int)
+}
+
+// typeDecoders holds the decoders for types with special handling. Note that
+// time.Duration, being an int64, is handled by the generic decoding.
+var typeDecoders = map[reflect.Type]typeDecoder{
+	reflect.TypeOf(time.Time{}): {fill: func(s *Source, v reflect.Value, _ int) {
+		v.Set(reflect.ValueOf(s.readTime()))
+	}},
+	reflect.TypeOf(big.Int{}): {fill: func(s *Source, v reflect.Value, _ int) {
+		s.readBigInt(v.Addr().Interface().(*big.Int))
+	}},
+	reflect.TypeOf(new(big.Int)): {fill: func(s *Source, v reflect.Value, _ int) {
+		v.Set(reflect.ValueOf(s.readBigInt(new(big.Int))))
+	}},
+	reflect.TypeOf(netip.Addr{}): {fill: func(s *Source, v reflect.Value, _ int) {
+		v.Set(reflect.ValueOf(s.readAddr()))
+	}},
+	reflect.TypeOf(netip.AddrPort{}): {fill: func(s *Source, v reflect.Value, _ int) {
+		addr := s.readAddr()
+		port := uint16(s.readUint(reflect.Uint16))
+		v.Set(reflect.ValueOf(netip.AddrPortFrom(addr, port)))
+	}},
+	reflect.TypeOf(net.IP{}): {fill: func(s *Source, v reflect.Value, _ int) {
+		v.Set(reflect.ValueOf(net.IP(s.readAddr().AsSlice())))
+	}},
+	reflect.TypeOf(url.URL{}): {dynamic: true, fill: func(s *Source, v reflect.Value, max int) {
+		v.Set(reflect.ValueOf(*s.readURL(max)))
+	}},
+	reflect.TypeOf(new(url.URL)): {dynamic: true, fill: func(s *Source, v reflect.Value, max int) {
+		v.Set(reflect.ValueOf(s.readURL(max)))
+	}},
+}
+
+const (
+	minUnixTime = -62135596800 // 0001-01-01T00:00:00Z
+	maxUnixTime = 253402300799 // 9999-12-31T23:59:59Z
+)
+
+// readTime reads a UTC time from 12 bytes: an int64 of seconds since the unix
+// epoch, which is wrapped into the years 1-9999, and a uint32 of nanoseconds
+// modulo 1e9.
+func (s *Source) readTime() time.Time {
+	var (
+		secs = s.readInt(reflect.Int64)
+		nsec = s.readUint(reflect.Uint32) % 1e9
+		span = uint64(maxUnixTime - minUnixTime + 1)
+	)
+	if secs < minUnixTime || secs > maxUnixTime {
+		secs = int64(uint64(secs-minUnixTime)%span) + minUnixTime
+	}
+	return time.Unix(secs, int64(nsec)).UTC()
+}
+
+// readBigInt reads an integer into x, and returns x. The first byte holds
+// the sign (highest bit) and the length of the big-endian magnitude (lower 7
+// bits), which follows.
+func (s *Source) readBigInt(x *big.Int) *big.Int {
+	hdr := byte(s.readUint(reflect.Uint8))
+	size := int(hdr & 0x7f)
+	if !s.allocate(size, 1) {
+		return x.SetInt64(0)
+	}
+	x.SetBytes(s.getBytes(size))
+	if hdr&0x80 != 0 {
+		x.Neg(x)
+	}
+	return x
+}
+
+// readAddr reads an IP address. The lowest bit of the first byte determines
+// whether 4 (IPv4) or 16 (IPv6) bytes follow.
+func (s *Source) readAddr() netip.Addr {
+	if s.readUint(reflect.Uint8)&0x1 == 0 {
+		return netip.AddrFrom4([4]byte(s.getBytes(4)))
+	}
+	return netip.AddrFrom16([16]byte(s.getBytes(16)))
+}
+
+// readURL reads a string of max bytes, and parses it as URL. If the string is
+// not a valid URL, it is used as the path of the URL instead.
+func (s *Source) readURL(max int) *url.URL {
+	if !s.allocate(max, 1) {
+		return new(url.URL)
+	}
+	str := decodeString(s.getBytes(max), s.strMode)
+	if u, err := url.Parse(str); err == nil {
+		return u
+	}
+	return &url.URL{Path: str}
+}
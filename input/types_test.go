@@ -0,0 +1,59 @@
+package input
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSpecialTypes(t *testing.T) {
+	for i, tc := range []struct {
+		input []byte
+		typ   any
+		want  string
+	}{
+		{[]byte{0, 0, 0, 0, 0x65, 0x4b, 0x2d, 0x80, 0, 0, 0, 1}, time.Time{}, "2023-11-08 06:41:04.000000001 +0000 UTC"},
+		{[]byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, time.Time{}, "7851-03-22 15:30:07.294967295 +0000 UTC"},
+		{[]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, time.Time{}, "1970-01-01 00:00:00 +0000 UTC"},
+		{[]byte{0, 0, 0, 0, 0, 0, 0, 10}, time.Duration(0), "10ns"},
+		{[]byte{0x02, 0x01, 0x00, 0xff}, big.Int{}, "256"},
+		{[]byte{0x82, 0x01, 0x00, 0xff}, new(big.Int), "-256"},
+		{[]byte{0x00}, new(big.Int), "0"},
+		{[]byte{0x00, 10, 0, 0, 1, 0x1f, 0x90}, netip.AddrPort{}, "10.0.0.1:8080"},
+		{[]byte{0x01, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, netip.Addr{}, "2001:db8::1"},
+		{[]byte{0x02, 192, 168, 0, 1}, net.IP{}, "192.168.0.1"},
+	} {
+		v := NewSource(tc.input).fillArg(reflect.TypeOf(tc.typ), 0)
+		have := fmt.Sprint(v.Interface())
+		if v.Kind() == reflect.Struct {
+			have = explainValue(v)
+		}
+		if have != tc.want {
+			t.Errorf("test %d (%T): have %q want %q", i, tc.typ, have, tc.want)
+		}
+	}
+}
+
+func TestSpecialTypesFillAndCall(t *testing.T) {
+	var have string
+	fuzzFunc := func(t *testing.T, u *url.URL, ip netip.Addr, s string, n *big.Int, u2 url.URL) {
+		have = fmt.Sprint(u, "|", ip, "|", s, "|", n, "|", &u2)
+	}
+	input := []byte{
+		0x00, 127, 0, 0, 1, // ip
+		0x01, 0x2a, // n
+		23, 3, 7, // weights
+	}
+	input = append(input, "https://example.com/foo"...)
+	input = append(input, "bar"...)
+	input = append(input, "%zz/baz"...)
+	NewSource(input).FillAndCall(fuzzFunc, reflect.ValueOf(new(testing.T)))
+	if want := "https://example.com/foo|127.0.0.1|bar|42|%25zz/baz"; have != want {
+		t.Fatalf("have %q want %q", have, want)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/maps"
+)
+
+var (
+	dryRunFlag = &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Generate the sources and show the go build command, without building. The sources are kept in a temporary directory, unless --keep-sources is given",
+	}
+
+	keepSourcesFlag = &cli.PathFlag{
+		Name: "keep-sources",
+		Usage: `Directory to keep the generated main, the rewritten files and the temporary module files in,
+along with a script 'build.sh' repeating the build`,
+	}
+)
+
+// keepSources copies the generated files into dir, so the build can be
+// inspected and repeated after the originals are removed. The sources map the
+// generated files, as seen by the build, to the files holding them. They are
+// referenced through an -overlay file, the temporary module files (see
+// shimOverlay) through the rewritten -modfile flag or GOWORK variable. It
+// returns the build flags and environment using the copies.
+func keepSources(dir string, sources map[string]string, flags, env []string) ([]string, []string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, err
+	}
+	var (
+		kept = make(map[string]string)
+		seen = make(map[string]bool)
+	)
+	paths := maps.Keys(sources)
+	slices.Sort(paths)
+	for _, path := range paths {
+		dst := filepath.Join(dir, filepath.Base(path))
+		if filepath.Base(filepath.Dir(path)) == xtestPkg {
+			dst = filepath.Join(dir, xtestPkg, filepath.Base(path))
+		}
+		if seen[dst] {
+			return nil, nil, fmt.Errorf("cannot keep %v, %v is taken", path, dst)
+		}
+		seen[dst] = true
+		if err := copyKept(sources[path], dst, nil); err != nil {
+			return nil, nil, err
+		}
+		kept[path] = dst
+	}
+	overlayPath, err := writeOverlay(filepath.Join(dir, "overlay.json"), kept)
+	if err != nil {
+		return nil, nil, err
+	}
+	flags, env = slices.Clone(flags), slices.Clone(env)
+	modDir := filepath.Join(dir, "mod")
+	for _, vars := range []struct {
+		list   []string
+		prefix string
+	}{{flags, "-modfile="}, {env, "GOWORK="}} {
+		for i, v := range vars.list {
+			path, ok := strings.CutPrefix(v, vars.prefix)
+			if !ok || !filepath.IsAbs(path) {
+				continue
+			}
+			if err := keepModDir(filepath.Dir(path), modDir); err != nil {
+				return nil, nil, err
+			}
+			vars.list[i] = vars.prefix + filepath.Join(modDir, filepath.Base(path))
+		}
+	}
+	return append(flags, "-overlay="+overlayPath), env, nil
+}
+
+// writeOverlay writes an overlay file for 'go build -overlay' to path, which
+// replaces the files in replace, as seen by the build, with the files they
+// map to. It returns the absolute path of the overlay file.
+func writeOverlay(path string, replace map[string]string) (string, error) {
+	abs := make(map[string]string, len(replace))
+	for from, to := range replace {
+		var err error
+		if from, err = filepath.Abs(from); err != nil {
+			return "", err
+		}
+		if abs[from], err = filepath.Abs(to); err != nil {
+			return "", err
+		}
+	}
+	data, err := json.MarshalIndent(struct{ Replace map[string]string }{abs}, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return filepath.Abs(path)
+}
+
+// keepModDir copies the temporary module files in tmp to dst. The go.work
+// file refers to the shim module within tmp, which is moved along.
+func keepModDir(tmp, dst string) error {
+	return filepath.WalkDir(tmp, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(tmp, path)
+		if err != nil {
+			return err
+		}
+		var replace func([]byte) []byte
+		if d.Name() == "go.work" {
+			replace = func(data []byte) []byte { return bytes.ReplaceAll(data, []byte(tmp), []byte(dst)) }
+		}
+		return copyKept(path, filepath.Join(dst, rel), replace)
+	})
+}
+
+// copyKept copies the file at src to dst, creating its directory, and applies
+// the optional replace function to the content.
+func copyKept(src, dst string, replace func([]byte) []byte) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if replace != nil {
+		data = replace(data)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o644)
+}
+
+// writeBuildScript writes a shell script running cmd, with the extra
+// environment env, to dir/build.sh.
+func writeBuildScript(dir string, cmd *exec.Cmd, env []string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	var line []string
+	for _, v := range env {
+		if k, val, ok := strings.Cut(v, "="); ok {
+			line = append(line, k+"="+shellQuote(val))
+		}
+	}
+	for _, arg := range cmd.Args {
+		line = append(line, shellQuote(arg))
+	}
+	script := fmt.Sprintf("#!/bin/sh\n# Repeats the build of the fuzzer, using the sources kept in this directory.\nset -e\ncd %v\n%v\n",
+		shellQuote(wd), strings.Join(line, " "))
+	return os.WriteFile(filepath.Join(dir, "build.sh"), []byte(script), 0o755)
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_./=,:@+%-]+$`)
+
+// shellQuote quotes s for use as a single word in a shell command.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
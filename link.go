@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	linkFlag = &cli.BoolFlag{
+		Name: "link",
+		Usage: `Link the archive into a libFuzzer executable. The archive is written to --output if it ends 
+with '.a' (and the executable to the same path without it), otherwise to '<output>.a'`,
+	}
+
+	linkerFlag = &cli.StringFlag{
+		Name:  "link.cc",
+		Usage: "The clang (C++) compiler used for linking (default: $CXX or clang++, or the engine's compiler, e.g. afl-clang-fast++ for --engine=aflpp)",
+	}
+
+	sanitizersFlag = &cli.StringSliceFlag{
+		Name:  "link.sanitizers",
+		Usage: `Additional sanitizers to link with, besides 'fuzzer'. Example: '--link.sanitizers=address,undefined'`,
+	}
+
+	linkLibsFlag = &cli.StringSliceFlag{
+		Name:  "link.lib",
+		Usage: `Runtime libraries of the fuzzing engine, for engines not linked via -fsanitize=fuzzer. Example: '--link.lib=libcentipede_runner.a'`,
+	}
+)
+
+// linkCC returns the compiler to link with for the engine: cc if set, else
+// $CXX for engines linking with plain clang++, else the engine's compiler. The
+// compilers of AFL++ and honggfuzz wrap clang to link in their runtimes, so an
+// unrelated $CXX (e.g. set for cgo) must not replace them.
+func linkCC(cc string, eng *engine) string {
+	if cc != "" {
+		return cc
+	}
+	if cxx := os.Getenv("CXX"); cxx != "" && eng.cc == "clang++" {
+		return cxx
+	}
+	return eng.cc
+}
+
+// linker links archives into executables.
+type linker struct {
+	cc         string   // path to the compiler
+	engine     *engine  // the engine to link with
+	sanitizers []string // sanitizers besides fuzzer
+	libs       []string // runtime libraries of the engine
+
+	// flags, if set, replace the engine-specific flags, sanitizers and
+	// libraries. OSS-Fuzz provides them via $CXXFLAGS and $LIB_FUZZING_ENGINE.
+	flags []string
+}
+
+// newLinker locates the compiler cc, and returns a linker using it to link with
+// the given engine.
+func newLinker(cc string, eng *engine, sanitizers, libs []string) (*linker, error) {
+	path, err := exec.LookPath(cc)
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			hint := "--" + linkerFlag.Name
+			if eng.cc == "" || eng.cc == "clang++" {
+				hint += " or $CXX"
+			}
+			return nil, fmt.Errorf("linker %q not found: install it, or set %v", cc, hint)
+		}
+		return nil, err
+	}
+	for _, s := range sanitizers {
+		if s == "" || strings.ContainsAny(s, ", ") {
+			return nil, fmt.Errorf("invalid sanitizer %q", s)
+		}
+	}
+	if eng.runtime != "" && len(libs) == 0 {
+		return nil, fmt.Errorf("engine %v needs its runtime library (%v), set --%v", eng.name, eng.runtime, linkLibsFlag.Name)
+	}
+	return &linker{cc: path, engine: eng, sanitizers: sanitizers, libs: libs}, nil
+}
+
+// linkOutputs returns the paths of the archive and the executable, for the
+// given --output.
+func linkOutputs(output string) (archive, exe string) {
+	if exe, ok := strings.CutSuffix(output, ".a"); ok && exe != "" {
+		return output, exe
+	}
+	return output + ".a", output
+}
+
+// command returns the command linking archive into the executable exe.
+func (l *linker) command(archive, exe string) *exec.Cmd {
+	if l.flags != nil {
+		args := append(slices.Clip(l.flags), archive, "-o", exe)
+		return exec.Command(l.cc, args...)
+	}
+	var args, sanitizers []string
+	if l.engine.sanitizeFuzzer {
+		sanitizers = append(sanitizers, "fuzzer")
+	}
+	sanitizers = append(sanitizers, l.sanitizers...)
+	if len(sanitizers) > 0 {
+		args = append(args, "-fsanitize="+strings.Join(sanitizers, ","))
+	}
+	args = append(args, archive)
+	if len(l.libs) > 0 {
+		args = append(args, "-Wl,--whole-archive")
+		args = append(args, l.libs...)
+		args = append(args, "-Wl,--no-whole-archive", "-ldl", "-lrt")
+	}
+	args = append(args, "-lpthread", "-o", exe)
+	return exec.Command(l.cc, args...)
+}
+
+// link links archive into the executable exe.
+func (l *linker) link(archive, exe string) error {
+	cmd := l.command(archive, exe)
+	slog.Info("Linking", "command", cmd)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintln(os.Stderr, string(out))
+		return fmt.Errorf("linking failed (is the %v runtime installed for %v?): %w", l.engine.name, l.cc, err)
+	}
+	return nil
+}
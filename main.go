@@ -8,6 +8,8 @@ import (
 	"go/token"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 
@@ -34,18 +36,15 @@ var (
 		Usage: `Target file(s) to rewrite imports of. This is typically: 
   1. The ".._test.go"-file which contains the main 'Fuzz(testing.F)'-function, and 
   2. Any other ".._test.go"-files which (1) relies upon, e.g. common testing-utilities or types.
+Files of the external test package (package foo_test) are supported. Defaults to the file declaring --func.
+The internal test files of the package are always rewritten.
 `,
-		Value: cli.NewStringSlice("gofuzz_libfuzzer", "libfuzzer"),
 	}
 
-	packageFlag = &cli.PathFlag{
-		Name:     "package",
-		Required: true,
-		Usage: `The package-path where the fuzzer resides. OBS! This is not not the same thing as the filesystem path. 
-
-For example, if your fuzzer FuzzBar() resides in  /home/user/go/src/github.com/holiman/bazonk/bar/goo/foo.go, then the 
-package-path is 'github.com/holiman/bazonk/bar/goo
-'`,
+	packageFlag = &cli.StringFlag{
+		Name: "package",
+		Usage: `The package where the fuzzer resides: an import path, a directory, or a pattern such as './...' 
+(in which case the package declaring --func is used). Example: 'github.com/holiman/bazonk/bar/goo' or './bar/goo'`,
 	}
 
 	outputFlag = &cli.StringFlag{
@@ -60,6 +59,23 @@ package-path is 'github.com/holiman/bazonk/bar/goo
 		Usage: `Arguments passed to the go builder. Example: '--build.arg="-overlay=foo.bar" --build.arg="--race"''`,
 	}
 
+	legacyFlag = &cli.BoolFlag{
+		Name: "legacy",
+		Usage: `Treat the fuzz function as a go-fuzz style target, 'func Fuzz(data []byte) int'. This is detected 
+automatically if the function is found in the files given by --fiximports.`,
+	}
+
+	initFlag = &cli.StringFlag{
+		Name:  "init",
+		Usage: "A function 'func()' of the target package to call once, when the engine initializes the fuzzer",
+	}
+
+	minLensFlag = &cli.IntSliceFlag{
+		Name: "min-lens",
+		Usage: `Minimum number of elements of the dynamic-sized arguments (strings and slices) of the fuzz target, 
+in argument order. Example: '--min-lens=4,1'`,
+	}
+
 	tagsFlag = &cli.StringSliceFlag{
 		Name:    "build.tags",
 		Aliases: []string{"tags"},
@@ -78,6 +94,25 @@ func init() {
 		outputFlag,
 		buildArgsFlag,
 		tagsFlag,
+		legacyFlag,
+		linkFlag,
+		linkerFlag,
+		sanitizersFlag,
+		linkLibsFlag,
+		engineFlag,
+		dictFlag,
+		minLensFlag,
+		initFlag,
+		dryRunFlag,
+		keepSourcesFlag,
+	}
+	app.Commands = []*cli.Command{
+		explainCommand,
+		upgradeCommand,
+		importCommand,
+		seedsCommand,
+		ossfuzzCommand,
+		buildCommand,
 	}
 }
 
@@ -89,37 +124,264 @@ func main() {
 }
 
 func shim(ctx *cli.Context) error {
+	cfg := &buildConfig{
+		pkg:         ctx.String(packageFlag.Name),
+		fuzzFunc:    ctx.String(fuzzFlag.Name),
+		tags:        ctx.StringSlice(tagsFlag.Name),
+		output:      ctx.String(outputFlag.Name),
+		legacy:      ctx.Bool(legacyFlag.Name),
+		minLens:     ctx.IntSlice(minLensFlag.Name),
+		initFunc:    ctx.String(initFlag.Name),
+		buildArgs:   ctx.StringSlice(buildArgsFlag.Name),
+		dryRun:      ctx.Bool(dryRunFlag.Name),
+		keepSources: ctx.Path(keepSourcesFlag.Name),
+	}
+	if cfg.pkg == "" {
+		return fmt.Errorf("required flag %q not set", packageFlag.Name)
+	}
+	if ctx.IsSet(targetsFlag.Name) {
+		cfg.files = ctx.StringSlice(targetsFlag.Name)
+	}
+	var err error
+	if cfg.engine, err = engineByName(ctx.String(engineFlag.Name)); err != nil {
+		return err
+	}
+	sanitizers, libs := ctx.StringSlice(sanitizersFlag.Name), ctx.StringSlice(linkLibsFlag.Name)
+	if ctx.Bool(linkFlag.Name) {
+		cc := linkCC(ctx.String(linkerFlag.Name), cfg.engine)
+		if cfg.linker, err = newLinker(cc, cfg.engine, sanitizers, libs); err != nil {
+			return err
+		}
+		cfg.output, cfg.exe = linkOutputs(cfg.output)
+	} else {
+		_, cfg.exe = linkOutputs(cfg.output)
+	}
+	if err := buildFuzzer(cfg); err != nil {
+		return err
+	}
+	if cfg.dryRun {
+		return nil
+	}
+	if cfg.linker == nil && cfg.engine.name != "libfuzzer" {
+		recipe := &linker{cc: cfg.engine.cc, engine: cfg.engine, sanitizers: sanitizers, libs: libs}
+		slog.Info("Link the archive with the engine's compiler", "command", recipe.command(cfg.output, cfg.exe))
+	}
+	if path := ctx.Path(dictFlag.Name); path != "" {
+		if err := writeDict(cfg, path); err != nil {
+			return err
+		}
+	}
+	if cfg.engine.setup != nil {
+		return cfg.engine.setup(cfg)
+	}
+	return nil
+}
+
+// gcflags is the instrumentation passed to the go compiler. It is consumed by
+// all engines, and can be overridden by a later -gcflags build argument.
+const gcflags = "all=-d=libfuzzer"
+
+// buildConfig configures the build of a single fuzzer.
+type buildConfig struct {
+	pkg       string   // import path of the target package
+	files     []string // files to rewrite the imports of, default the file declaring fuzzFunc
+	fuzzFunc  string   // name of the fuzz target
+	output    string   // output archive
+	exe       string   // output executable, if linking
+	buildArgs []string // extra arguments for go build
+	tags      []string // build tags
+	env       []string // extra environment for go build
+	legacy    bool     // the target is a go-fuzz style target
+	minLens   []int    // minimum lengths of the dynamic-sized arguments
+	initFunc  string   // function of the target package to call on initialization
+	engine    *engine
+	linker    *linker // nil if the archive is not linked
+
+	dryRun      bool   // generate the sources, but don't build
+	keepSources string // directory to keep the generated sources in, if set
+}
+
+// buildFuzzer builds the fuzzer described by cfg into an archive, and links it
+// if cfg.linker is set.
+func buildFuzzer(cfg *buildConfig) error {
+	pkg, err := resolvePackage(cfg.pkg, cfg.fuzzFunc, cfg.tags)
+	if err != nil {
+		return err
+	}
+	if pkg.ImportPath != cfg.pkg {
+		slog.Info("Resolved package", "package", cfg.pkg, "import-path", pkg.ImportPath)
+		cfg.pkg = pkg.ImportPath
+	}
+	if len(cfg.files) == 0 {
+		path, err := pkg.declaring(cfg.fuzzFunc)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			return fmt.Errorf("fuzz target %v not found in package %v", cfg.fuzzFunc, cfg.pkg)
+		}
+		cfg.files = []string{path}
+	}
+	files := slices.Clip(cfg.files)
 	var (
-		targetPkg   = ctx.Path(packageFlag.Name)
-		targetFiles = ctx.StringSlice(targetsFlag.Name)
-		fuzzFunc    = ctx.String(fuzzFlag.Name)
-		tags        = ctx.StringSlice(tagsFlag.Name)
-		outputFile  = ctx.String(outputFlag.Name)
-		buildArgs   = append(ctx.StringSlice(buildArgsFlag.Name), "-gcflags", "all=-d=libfuzzer", "-buildmode=c-archive")
+		legacy     = cfg.legacy
+		buildArgs  = append([]string{"-gcflags", gcflags, "-buildmode=c-archive"}, cfg.buildArgs...)
+		targetPath = cfg.pkg
+		// sources maps the generated files, as seen by the build, to the
+		// files holding them. Files outside the source tree are added via
+		// an -overlay.
+		sources = make(map[string]string)
 	)
 	slog.Info("Fuzz-builder starting",
-		"function", fuzzFunc, "to-rewrite", strings.Join(targetFiles, ","),
-		"package", targetPkg, "output", outputFile, "buildflags", buildArgs,
-		"tags", tags)
-	for _, path := range targetFiles {
-		slog.Info("Rewriting imports", "file", path)
-		restoreFn, err := rewriteImport(path, fuzzFunc, "github.com/holiman/gofuzz-shim/testing")
+		"function", cfg.fuzzFunc, "to-rewrite", strings.Join(files, ","),
+		"package", cfg.pkg, "output", cfg.output, "buildflags", buildArgs,
+		"tags", cfg.tags, "engine", cfg.engine.name)
+	if !legacy {
+		var err error
+		if legacy, err = isLegacy(files, cfg.fuzzFunc); err != nil {
+			slog.Warn("Failed to inspect fuzz function", "err", err)
+		}
+	}
+	var decoder string
+	if legacy {
+		slog.Info("Using go-fuzz style target, not rewriting imports")
+		if len(cfg.minLens) > 0 {
+			slog.Warn("Ignoring minimum lengths for go-fuzz style target", "min-lens", cfg.minLens)
+		}
+	} else {
+		args, err := fuzzArgs(files, cfg.fuzzFunc)
+		if err != nil {
+			slog.Warn("Failed to determine fuzz arguments", "err", err)
+		}
+		if decoder, err = genDecoder(cfg.fuzzFunc, args); err != nil {
+			return err
+		}
+		if decoder == "" {
+			slog.Info("Using reflection-based decoder", "args", strings.Join(args, ","))
+		} else {
+			slog.Info("Using generated decoder", "args", strings.Join(args, ","))
+		}
+		xtest, err := externalTest(pkg, cfg.tags)
 		if err != nil {
 			return err
 		}
-		defer restoreFn()
+		// The internal test files are compiled along with the target, as
+		// 'go test' does, so helpers (such as export_test.go for the
+		// external tests) are available.
+		for _, name := range pkg.TestGoFiles {
+			if path := filepath.Join(pkg.Dir, name); !containsFile(files, path) {
+				files = append(files, path)
+			}
+		}
+		var tmp string
+		for _, path := range files {
+			if xtest == nil || !xtest.contains(path) {
+				slog.Info("Rewriting imports", "file", path)
+				restoreFn, err := rewriteImport(path, cfg.fuzzFunc, "github.com/holiman/gofuzz-shim/testing")
+				if err != nil {
+					return err
+				}
+				defer restoreFn()
+				sources[path+"_fuzz.go"] = path + "_fuzz.go"
+				continue
+			}
+			// The external test package can't be imported from its own
+			// directory, so it is built as a package in a subdirectory,
+			// which only exists in the overlay.
+			if tmp == "" {
+				if tmp, err = os.MkdirTemp("", "gofuzz-shim-xtest-"); err != nil {
+					return err
+				}
+				defer os.RemoveAll(tmp)
+			}
+			name := filepath.Base(path) + "_fuzz.go"
+			slog.Info("Rewriting imports of external test", "file", path, "package", cfg.pkg+"/"+xtestPkg)
+			if err := writeRewritten(path, filepath.Join(tmp, name), "github.com/holiman/gofuzz-shim/testing"); err != nil {
+				return err
+			}
+			sources[filepath.Join(xtest.Dir, xtestPkg, name)] = filepath.Join(tmp, name)
+			if fn, err := findFunc([]string{path}, cfg.fuzzFunc); err != nil {
+				return err
+			} else if fn != nil {
+				targetPath = cfg.pkg + "/" + xtestPkg
+			}
+		}
+		if tmp != "" && cfg.keepSources == "" {
+			overlay, err := writeOverlay(filepath.Join(tmp, "overlay.json"), sources)
+			if err != nil {
+				return err
+			}
+			buildArgs = append(buildArgs, "-overlay="+overlay)
+		}
 	}
-	main, err := createMain(targetPkg, fuzzFunc)
+	main, err := createMain(&mainTarget{
+		PkgPath: targetPath,
+		Func:    cfg.fuzzFunc,
+		Decoder: decoder,
+		Legacy:  legacy,
+		Engine:  cfg.engine.name,
+		Entry:   cfg.engine.template,
+		Init:    cfg.initFunc,
+		MinLens: cfg.minLens,
+	})
 	if err != nil {
 		return err
 	}
-	if err := goTidy(); err != nil {
+	defer os.Remove(main)
+	sources[main] = main
+	modFlags, modEnv, cleanup, err := shimOverlay(".", currentShim())
+	if err != nil {
 		return err
 	}
-	return build(main, outputFile, buildArgs, tags)
+	defer cleanup()
+	var (
+		flags = append(buildArgs, modFlags...)
+		env   = append(slices.Clip(cfg.env), modEnv...)
+	)
+	if cfg.dryRun && cfg.keepSources == "" {
+		// The generated files are removed on return, keep them for inspection
+		if cfg.keepSources, err = os.MkdirTemp("", "gofuzz-shim-src-"); err != nil {
+			return err
+		}
+	}
+	if cfg.keepSources != "" {
+		if flags, env, err = keepSources(cfg.keepSources, sources, flags, env); err != nil {
+			return err
+		}
+		if err := writeBuildScript(cfg.keepSources, goBuild(main, cfg.output, flags, cfg.tags, env), env); err != nil {
+			return err
+		}
+		slog.Info("Kept sources", "dir", cfg.keepSources)
+	}
+	if cfg.dryRun {
+		slog.Info("Dry run, not building", "command", goBuild(main, cfg.output, flags, cfg.tags, env), "env", env)
+		return nil
+	}
+	if err := build(main, cfg.output, flags, cfg.tags, env); err != nil {
+		return err
+	}
+	if cfg.linker == nil {
+		return nil
+	}
+	if err := cfg.linker.link(cfg.output, cfg.exe); err != nil {
+		return err
+	}
+	slog.Info("Linked fuzzer", "executable", cfg.exe)
+	return nil
+}
+
+func build(main, out string, buildFlags, tags, env []string) error {
+	cmd := goBuild(main, out, buildFlags, tags, env)
+	slog.Info("Building", "command", cmd)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintln(os.Stderr, string(out))
+		return err
+	}
+	return nil
 }
 
-func build(main, out string, buildFlags, tags []string) error {
+// goBuild returns the go build command building main into out.
+func goBuild(main, out string, buildFlags, tags, env []string) *exec.Cmd {
 	args := []string{"build", "-o", out}
 	args = append(args, buildFlags...)
 	if len(tags) > 0 {
@@ -127,17 +389,34 @@ func build(main, out string, buildFlags, tags []string) error {
 	}
 	args = append(args, main)
 	cmd := exec.Command("go", args...)
-	slog.Info("Building", "command", cmd)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		fmt.Fprintln(os.Stderr, string(out))
-		return err
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
 	}
-	return nil
+	return cmd
+}
+
+// mainTarget describes the fuzz target for which a main file is generated.
+type mainTarget struct {
+	PkgPath string // import path of the target package
+	Func    string // name of the fuzz target
+	Decoder string // optional generated decoder, see genDecoder
+	Legacy  bool   // the target is a go-fuzz style 'func(data []byte) int'
+	Engine  string // name of the fuzzing engine
+	Entry   string // template defining the entry points for the engine
+	Init    string // optional function of the target package to call on initialization
+	MinLens []int  // minimum lengths of the dynamic-sized arguments
 }
 
 // createMain creates a new main.xx.go-file in the current directory,
 // and returns the path to the new file.
-func createMain(targetPkg, fuzzFunc string) (string, error) {
+func createMain(target *mainTarget) (string, error) {
+	tmpl, err := mainTmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmpl.New("entry").Parse(fmt.Sprintf("{{template %q .}}", target.Entry)); err != nil {
+		return "", err
+	}
 	mainFile, err := os.CreateTemp(".", "main.*.go")
 	if err != nil {
 		slog.Error("Failed to create tempfile", "err", err)
@@ -145,46 +424,34 @@ func createMain(targetPkg, fuzzFunc string) (string, error) {
 	}
 	slog.Info("Wrote main entry point for fuzzing", "file", mainFile.Name())
 	defer mainFile.Close()
-	type pkgFunc struct {
-		PkgPath string
-		Func    string
-	}
-	return mainFile.Name(), mainTmpl.Execute(mainFile, &pkgFunc{targetPkg, fuzzFunc})
+	return mainFile.Name(), tmpl.Execute(mainFile, target)
 }
 
-func goTidy() error {
-	if out, err := exec.Command("go", "mod", "tidy").CombinedOutput(); err != nil {
-		fmt.Fprintln(os.Stderr, string(out))
-		return err
+// containsFile reports whether any of the paths refers to the file at path.
+func containsFile(paths []string, path string) bool {
+	for _, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil && abs == path {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
+// xtestPkg is the directory, below the target package, in which the files of
+// the external test package are built.
+const xtestPkg = "gofuzzshim_xtest"
+
 func rewriteImport(path, fuzzerName, newImport string) (restoreFn func(), err error) {
-	var fset = token.NewFileSet()
-	astFile, err := parser.ParseFile(fset, path, nil, 0)
-	if err != nil {
-		return nil, err
-	}
-	// Replace import path, if needed
-	if astutil.DeleteImport(fset, astFile, "testing") {
-		astutil.AddImport(fset, astFile, newImport)
-	} else {
-		slog.Warn("No imports to replace", "file", path)
-	}
 	// Write into new file
 	fuzzPath := path + "_fuzz.go"
-	if newFile, err := os.Create(fuzzPath); err != nil {
-		return nil, fmt.Errorf("failed to create new file: %v", err)
-	} else {
-		printer.Fprint(newFile, fset, astFile)
-		newFile.Close()
-		slog.Info("Created new file", "name", newFile.Name())
+	if err := writeRewritten(path, fuzzPath, newImport); err != nil {
+		return nil, err
 	}
 	// Rename old file
 	savePath := fmt.Sprintf("%v.orig", path)
 	slog.Info("Saving original file", "path", savePath)
 	if err := os.Rename(path, savePath); err != nil {
+		os.Remove(fuzzPath)
 		return nil, err
 	}
 	restoreFunc := func() {
@@ -194,3 +461,29 @@ func rewriteImport(path, fuzzerName, newImport string) (restoreFn func(), err er
 	}
 	return restoreFunc, nil
 }
+
+// writeRewritten writes the file at path to dst, with the 'testing' import
+// replaced by newImport.
+func writeRewritten(path, dst, newImport string) error {
+	var fset = token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, path, nil, 0)
+	if err != nil {
+		return err
+	}
+	// Replace import path, if needed
+	if astutil.DeleteImport(fset, astFile, "testing") {
+		astutil.AddImport(fset, astFile, newImport)
+	} else {
+		slog.Warn("No imports to replace", "file", path)
+	}
+	newFile, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create new file: %v", err)
+	}
+	defer newFile.Close()
+	if err := printer.Fprint(newFile, fset, astFile); err != nil {
+		return err
+	}
+	slog.Info("Created new file", "name", newFile.Name())
+	return nil
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// shimModule is the module providing the packages imported by the generated
+// main file.
+const shimModule = "github.com/holiman/gofuzz-shim"
+
+// placeholderVersion is the version required of modules which are replaced by
+// a local directory.
+const placeholderVersion = "v0.0.0-00010101000000-000000000000"
+
+// shimVersion returns the version of the shim module this tool was built
+// from, or an empty string if unknown (e.g. when built from a checkout).
+func shimVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Path != shimModule || info.Main.Version == "(devel)" {
+		return ""
+	}
+	return info.Main.Version
+}
+
+// shimSource returns the source directory of the shim module this tool was
+// built from, or an empty string if it is not available (e.g. with -trimpath).
+func shimSource() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok || !filepath.IsAbs(file) {
+		return ""
+	}
+	dir := filepath.Dir(file)
+	if modulePath(dir) != shimModule {
+		return ""
+	}
+	return dir
+}
+
+// modulePath returns the path of the module in dir, or an empty string if
+// there is none.
+func modulePath(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	return modfile.ModulePath(data)
+}
+
+// shimRequirement is how builds get the shim module: either a version to
+// require, or a local directory to replace it with.
+type shimRequirement struct {
+	version string // version to require, empty for the latest
+	dir     string // directory replacing the module, if set
+}
+
+// currentShim returns the requirement for the shim module this tool was built
+// from. Versions stamped from version control (pseudo-versions, possibly
+// '+dirty') need not be published, so the source directory is used instead,
+// if available.
+func currentShim() shimRequirement {
+	version := shimVersion()
+	if version != "" && !module.IsPseudoVersion(version) && !strings.Contains(version, "+") {
+		return shimRequirement{version: version}
+	}
+	if dir := shimSource(); dir != "" {
+		return shimRequirement{dir: dir}
+	}
+	if strings.Contains(version, "+") {
+		version = "" // modified checkout, never published
+	}
+	return shimRequirement{version: version}
+}
+
+// goEnv returns the values of the given go environment variables.
+func goEnv(dir string, vars ...string) (map[string]string, error) {
+	cmd := exec.Command("go", append([]string{"env", "-json"}, vars...)...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go env: %w", err)
+	}
+	env := make(map[string]string)
+	return env, json.Unmarshal(out, &env)
+}
+
+// goCommand runs a go command in dir, with extra environment.
+func goCommand(dir string, env []string, args ...string) error {
+	_, err := goOutput(dir, env, args...)
+	return err
+}
+
+// goOutput runs a go command in dir, with extra environment, and returns its
+// standard output.
+func goOutput(dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w\n%s", cmd, err, stderr.Bytes())
+	}
+	return out, nil
+}
+
+// shimOverlay makes the shim module available to builds in dir, without
+// touching the go.mod, go.sum or go.work files there. It returns the go build
+// flags and environment to use, and a function removing the temporary files.
+//
+// In module mode, the build uses a copy of go.mod and go.sum via -modfile. In
+// workspace mode, it uses a copy of go.work, with an extra module requiring
+// the shim. In vendor mode, the shim must be vendored already.
+func shimOverlay(dir string, shim shimRequirement) (flags, env []string, cleanup func(), err error) {
+	vars, err := goEnv(dir, "GOMOD", "GOWORK", "GOFLAGS")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	gomod, gowork := vars["GOMOD"], vars["GOWORK"]
+	if gomod == "" || gomod == os.DevNull {
+		// GOPATH mode, nothing to do
+		return nil, nil, func() {}, nil
+	}
+	if gowork == "" || gowork == "off" {
+		if vendored, err := vendorMode(gomod, vars["GOFLAGS"]); err != nil || vendored {
+			return nil, nil, func() {}, err
+		}
+	}
+	tmp, err := os.MkdirTemp("", "gofuzz-shim-mod-")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cleanup = func() { os.RemoveAll(tmp) }
+	if gowork == "" || gowork == "off" {
+		flags, err = modfileOverlay(tmp, gomod, shim)
+	} else {
+		env, err = workOverlay(tmp, gowork, shim)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+	slog.Info("Using temporary module files", "dir", tmp, "flags", flags, "env", env)
+	return flags, env, cleanup, nil
+}
+
+// vendorMode reports whether the module of gomod is built from its vendor
+// directory, given the GOFLAGS. The -modfile copy can't be used then, as the
+// vendor directory would have to match it, so the shim must be vendored
+// already. It returns an error if it is not.
+func vendorMode(gomod, goflags string) (bool, error) {
+	modulesTxt := filepath.Join(filepath.Dir(gomod), "vendor", "modules.txt")
+	vendored, err := os.ReadFile(modulesTxt)
+	switch {
+	case strings.Contains(goflags, "-mod=mod"), strings.Contains(goflags, "-mod=readonly"):
+		return false, nil
+	case os.IsNotExist(err) && !strings.Contains(goflags, "-mod=vendor"):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	if !bytes.Contains(vendored, []byte("# "+shimModule+" ")) {
+		return true, fmt.Errorf("building in vendor mode, but %v is not vendored: require it in %v and run 'go mod vendor', or set GOFLAGS=-mod=mod",
+			shimModule, gomod)
+	}
+	slog.Info("Using the vendored shim module", "vendor", filepath.Dir(modulesTxt))
+	return true, nil
+}
+
+// modfileOverlay copies go.mod and go.sum into tmp, requiring the shim in the
+// copy, and returns the flags to build with it.
+func modfileOverlay(tmp, gomod string, shim shimRequirement) ([]string, error) {
+	modPath := filepath.Join(tmp, "go.mod")
+	for _, f := range [][2]string{
+		{gomod, modPath},
+		{gomod[:len(gomod)-len(".mod")] + ".sum", filepath.Join(tmp, "go.sum")},
+	} {
+		data, err := os.ReadFile(f[0])
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(f[1], data, 0644); err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return nil, err
+	}
+	mf, err := modfile.ParseLax(gomod, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	var edit []string
+	switch {
+	case mf.Module != nil && mf.Module.Mod.Path == shimModule, replaces(mf.Replace, shimModule):
+		// Provided by the module itself, or its replacement
+	case shim.dir != "":
+		edit = []string{"-require=" + shimModule + "@" + placeholderVersion, "-replace=" + shimModule + "=" + shim.dir}
+	case shim.version != "":
+		edit = []string{"-require=" + shimModule + "@" + shim.version}
+	}
+	if len(edit) > 0 {
+		args := append([]string{"mod", "edit", "-modfile=" + modPath}, edit...)
+		if err := goCommand(filepath.Dir(gomod), nil, args...); err != nil {
+			return nil, err
+		}
+	}
+	// With -mod=mod, missing requirements are added to the copy.
+	return []string{"-modfile=" + modPath, "-mod=mod"}, nil
+}
+
+// replaces reports whether any of the replace directives replaces path.
+func replaces(replace []*modfile.Replace, path string) bool {
+	for _, r := range replace {
+		if r.Old.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// workFile is the subset of 'go work edit -json' used by workOverlay.
+type workFile struct {
+	Go      string
+	Use     []struct{ DiskPath string }
+	Replace []struct {
+		Old, New struct{ Path, Version string }
+	}
+}
+
+// workOverlay copies go.work and go.work.sum into tmp, with the module and
+// replacement paths made absolute, and adds a module requiring the shim. It
+// returns the environment to build with it.
+//
+// The requirements are resolved within the workspace, so replacements of the
+// shim in go.work apply, and no network access is needed if the modules are
+// in the module cache. Missing checksums are added to the copy of go.work.sum
+// by the build.
+func workOverlay(tmp, gowork string, shim shimRequirement) ([]string, error) {
+	data, err := os.ReadFile(gowork)
+	if err != nil {
+		return nil, err
+	}
+	workPath := filepath.Join(tmp, "go.work")
+	if err := os.WriteFile(workPath, data, 0644); err != nil {
+		return nil, err
+	}
+	if sum, err := os.ReadFile(gowork + ".sum"); err == nil {
+		if err := os.WriteFile(workPath+".sum", sum, 0644); err != nil {
+			return nil, err
+		}
+	}
+	out, err := goOutput(tmp, nil, "work", "edit", "-json", workPath)
+	if err != nil {
+		return nil, err
+	}
+	var work workFile
+	if err := json.Unmarshal(out, &work); err != nil {
+		return nil, err
+	}
+	// Make the paths absolute, as they are relative to the go.work file
+	var (
+		args     = []string{"work", "edit"}
+		base     = filepath.Dir(gowork)
+		provided bool   // the shim is a workspace module
+		version  string // the shim version to require
+	)
+	for _, use := range work.Use {
+		abs := use.DiskPath
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(base, abs)
+			args = append(args, "-dropuse="+use.DiskPath, "-use="+abs)
+		}
+		provided = provided || modulePath(abs) == shimModule
+	}
+	replaced := false
+	for _, r := range work.Replace {
+		old := r.Old.Path
+		if r.Old.Version != "" {
+			old += "@" + r.Old.Version
+		}
+		if r.Old.Path == shimModule {
+			replaced, version = true, r.Old.Version
+		}
+		if r.New.Version != "" || filepath.IsAbs(r.New.Path) {
+			continue
+		}
+		args = append(args, "-dropreplace="+old, "-replace="+old+"="+filepath.Join(base, r.New.Path))
+	}
+	if provided {
+		args = append(args, workPath)
+		return []string{"GOWORK=" + workPath}, goCommand(tmp, nil, args...)
+	}
+	switch {
+	case replaced:
+	case shim.dir != "":
+		args = append(args, "-replace="+shimModule+"="+shim.dir)
+	case shim.version != "":
+		version = shim.version
+	default:
+		out, err := goOutput(tmp, nil, "list", "-m", "-f", "{{.Version}}", shimModule+"@latest")
+		if err != nil {
+			return nil, err
+		}
+		version = strings.TrimSpace(string(out))
+	}
+	if version == "" {
+		version = placeholderVersion
+	}
+	// The shim module is required by a temporary module in the workspace.
+	shimDir := filepath.Join(tmp, "shim")
+	if err := os.MkdirAll(shimDir, 0755); err != nil {
+		return nil, err
+	}
+	gomod := "module gofuzz-shim.overlay\n"
+	if work.Go != "" {
+		gomod += fmt.Sprintf("\ngo %v\n", work.Go)
+	}
+	gomod += fmt.Sprintf("\nrequire %v %v\n", shimModule, version)
+	imports := fmt.Sprintf("package overlay\n\nimport (\n\t_ %q\n\t_ %q\n)\n", shimModule+"/input", shimModule+"/testing")
+	for name, content := range map[string]string{"go.mod": gomod, "overlay.go": imports} {
+		if err := os.WriteFile(filepath.Join(shimDir, name), []byte(content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	args = append(args, "-use="+shimDir, workPath)
+	if err := goCommand(tmp, nil, args...); err != nil {
+		return nil, err
+	}
+	return []string{"GOWORK=" + workPath}, nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/holiman/gofuzz-shim/input"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	ossfuzzCommand = &cli.Command{
+		Name:  "ossfuzz",
+		Usage: "Build all fuzz targets in the given packages for OSS-Fuzz",
+		Description: `Ossfuzz builds every native fuzz target (func FuzzXxx(f *testing.F)) in the test
+files of the given packages, and links it into $OUT/FuzzXxx. Alongside, it writes
+  - FuzzXxx_seed_corpus.zip, with the f.Add seeds and the testdata/fuzz/FuzzXxx corpus,
+  - FuzzXxx.dict, with testdata/fuzz/FuzzXxx.dict and the literals the package
+    and its dependencies compare against (see --dict),
+  - FuzzXxx.options, if any --option is given.
+It follows the OSS-Fuzz conventions: the archive is linked with
+'$CXX $CXXFLAGS $LIB_FUZZING_ENGINE', and cgo code is compiled with $CC and $CFLAGS.
+The engine is chosen by $FUZZING_ENGINE.`,
+		ArgsUsage: "<package> [<package>...]",
+		Flags: []cli.Flag{
+			ossfuzzOutFlag,
+			optionFlag,
+			buildArgsFlag,
+			tagsFlag,
+		},
+		Action: ossfuzz,
+	}
+
+	ossfuzzOutFlag = &cli.PathFlag{
+		Name:     "out",
+		Usage:    "Directory to write the fuzzers to",
+		EnvVars:  []string{"OUT"},
+		Required: true,
+	}
+
+	optionFlag = &cli.StringSliceFlag{
+		Name:  "option",
+		Usage: `libFuzzer options to write to the .options files. Example: '--option=max_len=4096'`,
+	}
+)
+
+// ossfuzzEngines maps the names used in $FUZZING_ENGINE to engines.
+var ossfuzzEngines = map[string]string{
+	"":          "libfuzzer",
+	"libfuzzer": "libfuzzer",
+	"afl":       "aflpp",
+	"honggfuzz": "honggfuzz",
+	"centipede": "centipede",
+}
+
+func ossfuzz(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("no packages given")
+	}
+	var (
+		out     = ctx.Path(ossfuzzOutFlag.Name)
+		tags    = ctx.StringSlice(tagsFlag.Name)
+		options = ctx.StringSlice(optionFlag.Name)
+	)
+	name, ok := ossfuzzEngines[os.Getenv("FUZZING_ENGINE")]
+	if !ok {
+		return fmt.Errorf("unsupported $FUZZING_ENGINE %q", os.Getenv("FUZZING_ENGINE"))
+	}
+	eng := engines[name]
+	l, err := ossfuzzLinker(eng)
+	if err != nil {
+		return err
+	}
+	pkgs, err := listPackages(ctx.Args().Slice(), tags, false)
+	if err != nil {
+		return err
+	}
+	var (
+		targets []*fuzzTarget
+		seen    = make(map[string]*fuzzTarget)
+	)
+	for _, pkg := range pkgs {
+		found, err := fuzzTargets(pkg)
+		if err != nil {
+			return err
+		}
+		for _, t := range found {
+			if prev := seen[t.name]; prev != nil {
+				return fmt.Errorf("fuzz target %v found in both %v and %v", t.name, prev.pkg.ImportPath, t.pkg.ImportPath)
+			}
+			seen[t.name] = t
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no fuzz targets found")
+	}
+	tmp, err := os.MkdirTemp("", "gofuzz-shim-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+	for _, t := range targets {
+		cfg := &buildConfig{
+			pkg:       t.pkg.ImportPath,
+			files:     []string{t.file},
+			fuzzFunc:  t.name,
+			output:    filepath.Join(tmp, t.name+".a"),
+			exe:       filepath.Join(out, t.name),
+			buildArgs: ctx.StringSlice(buildArgsFlag.Name),
+			tags:      tags,
+			env:       ossfuzzEnv(),
+			engine:    eng,
+			linker:    l,
+		}
+		if err := buildFuzzer(cfg); err != nil {
+			return fmt.Errorf("%v: %w", t.name, err)
+		}
+		if err := writeSeedCorpus(t, filepath.Join(out, t.name+"_seed_corpus.zip"), tags); err != nil {
+			return fmt.Errorf("%v: %w", t.name, err)
+		}
+		if err := writeTargetDict(t, filepath.Join(out, t.name+".dict"), tags); err != nil {
+			return fmt.Errorf("%v: %w", t.name, err)
+		}
+		if err := writeOptions(filepath.Join(out, t.name+".options"), options); err != nil {
+			return fmt.Errorf("%v: %w", t.name, err)
+		}
+	}
+	slog.Info("Built fuzzers", "out", out, "count", len(targets))
+	return nil
+}
+
+// ossfuzzLinker returns a linker following the OSS-Fuzz conventions.
+func ossfuzzLinker(eng *engine) (*linker, error) {
+	cxx := os.Getenv("CXX")
+	if cxx == "" {
+		cxx = "clang++"
+	}
+	l, err := newLinker(cxx, &engine{name: eng.name}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	l.flags = append(strings.Fields(os.Getenv("CXXFLAGS")), strings.Fields(os.Getenv("LIB_FUZZING_ENGINE"))...)
+	return l, nil
+}
+
+// ossfuzzEnv returns the environment for go build, passing the OSS-Fuzz
+// compiler flags on to cgo. The compilers ($CC, $CXX) are used by cgo as is.
+func ossfuzzEnv() []string {
+	var env []string
+	if flags := os.Getenv("CFLAGS"); flags != "" {
+		env = append(env, "CGO_CFLAGS="+flags)
+	}
+	if flags := os.Getenv("CXXFLAGS"); flags != "" {
+		env = append(env, "CGO_CXXFLAGS="+flags)
+	}
+	return env
+}
+
+// encodeSeeds returns the seeds of the target, encoded in the input layout and
+// prefixed with a header. Strings are encoded in the mode selected by the build
+// tags. Seeds which can't be encoded are skipped, as are all seeds if the
+// arguments of the target are not supported.
+func encodeSeeds(t *fuzzTarget, tags []string) ([][]byte, error) {
+	seeds, err := t.seeds()
+	if err != nil || len(seeds) == 0 {
+		return nil, err
+	}
+	args, err := fuzzArgs([]string{t.file}, t.name)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := fuzzFuncOf(args)
+	if err != nil {
+		slog.Warn("Skipping seeds", "target", t.name, "err", err)
+		return nil, nil
+	}
+	var out [][]byte
+	for _, seed := range seeds {
+		data, err := input.EncodeMode(stringModeForTags(tags), fn, seed...)
+		if err != nil {
+			slog.Warn("Skipping seed", "target", t.name, "err", err)
+			continue
+		}
+		out = append(out, input.AddHeader(data))
+	}
+	return out, nil
+}
+
+// seedName returns the file name for an encoded seed.
+func seedName(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeSeedCorpus writes the seeds of the target, encoded in the input layout,
+// into a zip file, for a build with the given tags. Nothing is written if there
+// are no seeds.
+func writeSeedCorpus(t *fuzzTarget, path string, tags []string) error {
+	seeds, err := encodeSeeds(t, tags)
+	if err != nil || len(seeds) == 0 {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, data := range seeds {
+		w, err := zw.Create(seedName(data))
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	slog.Info("Wrote seed corpus", "target", t.name, "file", path, "seeds", len(seeds))
+	return zw.Close()
+}
+
+// writeTargetDict writes the dictionary for the target to path: the entries of
+// testdata/fuzz/<target>.dict, if present, followed by the tokens extracted
+// from the package and its dependencies.
+func writeTargetDict(t *fuzzTarget, path string, tags []string) error {
+	data, err := os.ReadFile(t.corpusDir() + ".dict")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	tokens, err := packageTokens(t.pkg.ImportPath, tags)
+	if err != nil {
+		return err
+	}
+	args, _ := fuzzArgs([]string{t.file}, t.name)
+	var lines []string
+	for _, line := range strings.Split(string(data)+formatDict(encodeTokens(tokens, args, tags)), "\n") {
+		if line != "" && !slices.Contains(lines, line) {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// writeOptions writes the given libFuzzer options (key=value) to path.
+// Nothing is written if there are no options.
+func writeOptions(path string, options []string) error {
+	if len(options) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("[libfuzzer]\n")
+	for _, opt := range options {
+		key, val, ok := strings.Cut(opt, "=")
+		if !ok {
+			return fmt.Errorf("invalid option %q, want key=value", opt)
+		}
+		fmt.Fprintf(&b, "%v = %v\n", strings.TrimSpace(key), strings.TrimSpace(val))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
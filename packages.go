@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// goPackage is the subset of the 'go list -json' output used by gofuzz-shim.
+type goPackage struct {
+	ImportPath   string
+	Dir          string
+	Name         string
+	Standard     bool
+	GoFiles      []string
+	TestGoFiles  []string
+	XTestGoFiles []string // files of the external test package, foo_test
+	ForTest      string   // the package tested by this test variant, with -test
+}
+
+// listPackages resolves the given package patterns with 'go list'. If deps is
+// set, the dependencies of the packages are listed as well.
+func listPackages(patterns, tags []string, deps bool) ([]*goPackage, error) {
+	var flags []string
+	if deps {
+		flags = append(flags, "-deps")
+	}
+	return goList(patterns, tags, flags...)
+}
+
+// externalTest returns the external test package of pkg, as listed by
+// 'go list -test', or nil if it has none.
+func externalTest(pkg *goPackage, tags []string) (*goPackage, error) {
+	if len(pkg.XTestGoFiles) == 0 {
+		return nil, nil
+	}
+	// -e, as the test main can't be generated for packages with go-fuzz
+	// style Fuzz functions, which doesn't matter here.
+	pkgs, err := goList([]string{pkg.ImportPath}, tags, "-e", "-test")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pkgs {
+		if p.ForTest == pkg.ImportPath && p.Name == pkg.Name+"_test" {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// goList runs 'go list -json' with the extra flags on the package patterns.
+func goList(patterns, tags []string, flags ...string) ([]*goPackage, error) {
+	args := append([]string{"list", "-json"}, flags...)
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+	cmd := exec.Command("go", append(args, patterns...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list %v: %w\n%s", strings.Join(patterns, " "), err, stderr.Bytes())
+	}
+	var pkgs []*goPackage
+	for dec := json.NewDecoder(bytes.NewReader(out)); ; {
+		pkg := new(goPackage)
+		if err := dec.Decode(pkg); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// resolvePackage resolves the --package argument, which is either an import
+// path, a directory or a package pattern such as './...', to a package. If it
+// matches several packages, the one declaring fuzzFunc is chosen.
+func resolvePackage(pattern, fuzzFunc string, tags []string) (*goPackage, error) {
+	// 'go list' treats relative paths without a leading dot as import paths
+	if !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, ".") {
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			pattern = "./" + filepath.ToSlash(pattern)
+		}
+	}
+	pkgs, err := listPackages([]string{pattern}, tags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) == 1 {
+		return pkgs[0], nil
+	}
+	var found []*goPackage
+	for _, pkg := range pkgs {
+		if path, err := pkg.declaring(fuzzFunc); err != nil {
+			return nil, err
+		} else if path != "" {
+			found = append(found, pkg)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no package matching %v declares %v", pattern, fuzzFunc)
+	case 1:
+		return found[0], nil
+	}
+	var paths []string
+	for _, pkg := range found {
+		paths = append(paths, pkg.ImportPath)
+	}
+	return nil, fmt.Errorf("%v is declared in several packages matching %v: %v", fuzzFunc, pattern, strings.Join(paths, ", "))
+}
+
+// declaring returns the path of the file declaring the function fn, in the
+// package or its (internal or external) tests, or an empty string if none.
+func (pkg *goPackage) declaring(fn string) (string, error) {
+	for _, names := range [][]string{pkg.GoFiles, pkg.TestGoFiles, pkg.XTestGoFiles} {
+		for _, name := range names {
+			path := filepath.Join(pkg.Dir, name)
+			if decl, err := findFunc([]string{path}, fn); err != nil {
+				return "", err
+			} else if decl != nil {
+				return path, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// contains reports whether the file at path is one of the Go files of pkg.
+func (pkg *goPackage) contains(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil || filepath.Dir(abs) != filepath.Clean(pkg.Dir) {
+		return false
+	}
+	return slices.Contains(pkg.GoFiles, filepath.Base(abs))
+}
+
+// fuzzTarget is a native fuzz target, func FuzzXxx(f *testing.F).
+type fuzzTarget struct {
+	pkg  *goPackage
+	name string
+	file string // the file declaring the target
+}
+
+// fuzzTargets returns the fuzz targets declared in the (internal and external)
+// test files of pkg.
+func fuzzTargets(pkg *goPackage) ([]*fuzzTarget, error) {
+	var (
+		targets []*fuzzTarget
+		fset    = token.NewFileSet()
+	)
+	for _, name := range append(slices.Clip(pkg.TestGoFiles), pkg.XTestGoFiles...) {
+		path := filepath.Join(pkg.Dir, name)
+		astFile, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range astFile.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "Fuzz") || fn.Body == nil {
+				continue
+			}
+			if params := paramTypes(fn.Type); len(params) != 1 || params[0] != "*testing.F" || fn.Type.Results != nil {
+				continue
+			}
+			targets = append(targets, &fuzzTarget{pkg: pkg, name: fn.Name.Name, file: path})
+		}
+	}
+	return targets, nil
+}
+
+// corpusDir returns the directory holding the corpus of the target used by
+// 'go test -fuzz'.
+func (t *fuzzTarget) corpusDir() string {
+	return filepath.Join(t.pkg.Dir, "testdata", "fuzz", t.name)
+}
+
+// seeds returns the seeds of the target: the f.Add calls with constant
+// arguments, and the files in its go corpus directory.
+func (t *fuzzTarget) seeds() ([][]any, error) {
+	seeds, err := addedSeeds([]string{t.file}, t.name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(t.corpusDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(t.corpusDir(), entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		vals, err := parseGoCorpus(data)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", entry.Name(), err)
+		}
+		seeds = append(seeds, vals)
+	}
+	return seeds, nil
+}
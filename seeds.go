@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	//go:embed seeds_template.txt
+	seedsTmplText string
+	seedsTmpl     = template.Must(template.New("seeds").Parse(seedsTmplText))
+
+	seedsCommand = &cli.Command{
+		Name:  "seeds",
+		Usage: "Record the arguments of calls made by a unit test as seeds for a fuzz target",
+		Description: `Seeds instruments the test function --test in the given test file, so that
+every call to --call records its arguments. The test is then run, and each
+recorded call is encoded as an input for the fuzz target --func, and written
+to the --out directory. The called function must take the same arguments as
+the fuzz target (excluding *testing.T).`,
+		ArgsUsage: "<test-file>",
+		Flags: []cli.Flag{
+			fuzzFlag,
+			sourceFlag,
+			argTypesFlag,
+			testFlag,
+			callFlag,
+			seedsOutFlag,
+		},
+		Action: seeds,
+	}
+
+	testFlag = &cli.StringFlag{
+		Name:     "test",
+		Usage:    "The unit test to record calls in",
+		Required: true,
+	}
+
+	callFlag = &cli.StringFlag{
+		Name:     "call",
+		Usage:    `The function or method to record the arguments of. Example: '--call=Decode' or '--call=rlp.Decode'`,
+		Required: true,
+	}
+
+	seedsOutFlag = &cli.PathFlag{
+		Name:  "out",
+		Usage: "Directory to write the seeds to",
+		Value: "seeds",
+	}
+)
+
+// seedsHelper is the name of the file holding the recording helper, which is
+// created next to the instrumented test file.
+const seedsHelper = "zz_gofuzzshim_seeds_test.go"
+
+// seedImports maps the package qualifiers of the builtin argument types to
+// their import paths.
+var seedImports = map[string]string{
+	"time":  "time",
+	"big":   "math/big",
+	"netip": "net/netip",
+	"net":   "net",
+	"url":   "net/url",
+}
+
+func seeds(ctx *cli.Context) error {
+	args, err := fuzzArgsFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("expected one test file")
+	}
+	var (
+		path     = ctx.Args().First()
+		testFunc = ctx.String(testFlag.Name)
+		out      = ctx.Path(seedsOutFlag.Name)
+	)
+	if out, err = filepath.Abs(out); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pkg, instrumented, n, err := instrumentCalls(path, src, testFunc, ctx.String(callFlag.Name), args)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no calls to %v with %d arguments found in %v", ctx.String(callFlag.Name), len(args), testFunc)
+	}
+	slog.Info("Instrumented calls", "test", testFunc, "calls", n)
+	helper, err := genSeedsHelper(pkg, ctx.String(fuzzFlag.Name), args, out)
+	if err != nil {
+		return err
+	}
+	restoreFn, err := replaceFile(path, instrumented)
+	if err != nil {
+		return err
+	}
+	defer restoreFn()
+	helperPath := filepath.Join(filepath.Dir(path), seedsHelper)
+	if err := os.WriteFile(helperPath, helper, 0644); err != nil {
+		return err
+	}
+	defer os.Remove(helperPath)
+
+	// The helper imports the input package, so the test needs the shim
+	// module, like the fuzzer build.
+	modFlags, modEnv, cleanup, err := shimOverlay(filepath.Dir(path), currentShim())
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	before, _ := os.ReadDir(out)
+	testArgs := append(append([]string{"test", "-count=1"}, modFlags...), "-run", "^"+testFunc+"$", ".")
+	cmd := exec.Command("go", testArgs...)
+	cmd.Dir = filepath.Dir(path)
+	cmd.Env = append(os.Environ(), modEnv...)
+	slog.Info("Running test", "command", cmd, "env", modEnv)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintln(os.Stderr, string(out))
+		return err
+	}
+	after, _ := os.ReadDir(out)
+	slog.Info("Recorded seeds", "out", out, "new", len(after)-len(before))
+	return nil
+}
+
+// instrumentCalls rewrites all calls to call with len(args) arguments within
+// the function testFunc in the given source, so that the arguments are
+// recorded. It returns the package name, the instrumented source and the
+// number of instrumented calls.
+func instrumentCalls(path string, src []byte, testFunc, call string, args []string) (string, []byte, int, error) {
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	var fn *ast.FuncDecl
+	for _, decl := range astFile.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok && d.Recv == nil && d.Name.Name == testFunc && d.Body != nil {
+			fn = d
+		}
+	}
+	if fn == nil {
+		return "", nil, 0, fmt.Errorf("test %v not found in %v", testFunc, path)
+	}
+	var count int
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		c, ok := node.(*ast.CallExpr)
+		if !ok || len(c.Args) != len(args) || c.Ellipsis.IsValid() || !isCallTo(c.Fun, call) {
+			return true
+		}
+		n := &ast.BasicLit{Kind: token.INT, Value: fmt.Sprint(len(args))}
+		for i, arg := range c.Args {
+			var record ast.Expr = ast.NewIdent("gofuzzshimRecord")
+			// Untyped constants and nil need the type spelled out, since it
+			// can't be inferred from them.
+			if isUntyped(arg) {
+				typ, err := parser.ParseExpr(args[i])
+				if err != nil {
+					return true
+				}
+				record = &ast.IndexExpr{X: record, Index: typ}
+			}
+			c.Args[i] = &ast.CallExpr{
+				Fun:  record,
+				Args: []ast.Expr{n, &ast.BasicLit{Kind: token.INT, Value: fmt.Sprint(i)}, arg},
+			}
+		}
+		count++
+		// Calls nested in the arguments are not instrumented, their
+		// recording would wait for the lock held by this call.
+		return false
+	})
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, astFile); err != nil {
+		return "", nil, 0, err
+	}
+	return astFile.Name.Name, buf.Bytes(), count, nil
+}
+
+// isCallTo reports whether fun refers to call, which is either a plain name
+// matching functions and methods, or a qualified name 'x.Name'.
+func isCallTo(fun ast.Expr, call string) bool {
+	qual, name, qualified := strings.Cut(call, ".")
+	if !qualified {
+		name = qual
+	}
+	switch f := fun.(type) {
+	case *ast.Ident:
+		return !qualified && f.Name == name
+	case *ast.SelectorExpr:
+		if f.Sel.Name != name {
+			return false
+		}
+		if !qualified {
+			return true
+		}
+		x, ok := f.X.(*ast.Ident)
+		return ok && x.Name == qual
+	}
+	return false
+}
+
+// isUntyped reports whether expr is nil or a (possibly negated) basic literal.
+func isUntyped(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.Ident:
+		return e.Name == "nil"
+	case *ast.UnaryExpr:
+		return (e.Op == token.SUB || e.Op == token.ADD) && isUntyped(e.X)
+	case *ast.ParenExpr:
+		return isUntyped(e.X)
+	}
+	return false
+}
+
+// genSeedsHelper generates the helper file which records arguments and writes
+// them as seeds for the fuzz target with the given arguments to out.
+func genSeedsHelper(pkg, fuzzFunc string, args []string, out string) ([]byte, error) {
+	imports := make(map[string]bool)
+	for _, arg := range args {
+		if _, ok := typeOf(arg); !ok {
+			return nil, fmt.Errorf("unsupported argument type %q", arg)
+		}
+		if qual, _, ok := strings.Cut(strings.TrimLeft(arg, "[]*"), "."); ok {
+			imports[seedImports[qual]] = true
+		}
+	}
+	var paths []string
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	var buf bytes.Buffer
+	type helper struct {
+		Package string
+		Imports []string
+		Func    string
+		Args    string
+		Out     string
+	}
+	if err := seedsTmpl.Execute(&buf, &helper{pkg, paths, fuzzFunc, strings.Join(args, ", "), out}); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// replaceFile replaces the file at path with the given content, saving the
+// original, and returns a function which restores it.
+func replaceFile(path string, content []byte) (restoreFn func(), err error) {
+	savePath := fmt.Sprintf("%v.orig", path)
+	slog.Info("Saving original file", "path", savePath)
+	if err := os.Rename(path, savePath); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		os.Rename(savePath, path)
+		return nil, err
+	}
+	restoreFunc := func() {
+		slog.Info("Restoring file", "restoring", path)
+		os.Rename(savePath, path)
+	}
+	return restoreFunc, nil
+}
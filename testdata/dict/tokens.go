@@ -0,0 +1,39 @@
+package tokens
+
+import (
+	"bytes"
+	"strings"
+)
+
+const (
+	pdfMagic        = "%PDF-"
+	hdrV1    uint32 = 0x01020304
+	unused          = "not compared either"
+)
+
+func parse(data []byte, s string, n uint32) int {
+	if bytes.HasPrefix(data, []byte(pdfMagic)) {
+		return 6
+	}
+	switch n {
+	case hdrV1:
+		return 7
+	}
+	if bytes.HasPrefix(data, []byte("\x89PNG")) {
+		return 1
+	}
+	if strings.Contains(s, "<script>") || s != "magic\"quote" {
+		return 2
+	}
+	switch s {
+	case "GET", "POST":
+		return 3
+	case "":
+		return 4
+	}
+	if n == 0xcafebabe || n > 10 {
+		return 5
+	}
+	x := "not compared"
+	return len(x)
+}
@@ -0,0 +1,8 @@
+package ossfuzz
+
+// ParseKinds parses data as each of the known kinds, for the external tests.
+func ParseKinds(data string) {
+	for _, kind := range []uint8{1, 2, 3} {
+		Parse(kind, data)
+	}
+}
@@ -0,0 +1,8 @@
+package ossfuzz
+
+func Parse(kind uint8, data string) bool {
+	if len(data) == 0x5de {
+		return false
+	}
+	return kind == 1 && data == "magic"
+}
@@ -0,0 +1,15 @@
+package ossfuzz_test
+
+import (
+	"testing"
+
+	"github.com/holiman/gofuzz-shim/testdata/ossfuzz"
+)
+
+func FuzzParseExternal(f *testing.F) {
+	f.Add(uint8(1), "magic")
+	f.Fuzz(func(t *testing.T, kind uint8, data string) {
+		ossfuzz.Parse(kind, data)
+		ossfuzz.ParseKinds(data)
+	})
+}
@@ -0,0 +1,20 @@
+package ossfuzz
+
+import "testing"
+
+func FuzzParse(f *testing.F) {
+	f.Add(uint8(1), "magic")
+	f.Add(2, "")
+	for _, s := range []string{"a", "b"} {
+		f.Add(3, s)
+	}
+	f.Fuzz(func(t *testing.T, kind uint8, data string) {
+		Parse(kind, data)
+	})
+}
+
+func FuzzNothing(f *testing.F) {}
+
+func TestParse(t *testing.T) {}
+
+func FuzzHelper(data []byte) int { return 0 }
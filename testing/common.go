@@ -22,7 +22,7 @@ func (c *common) Finished() {
 
 func (c *common) Log(args ...any)                 { fmt.Print(args...) }
 func (c *common) Logf(format string, args ...any) { fmt.Printf(format, args...) }
-func (c *common) Name() string                    { return "libFuzzer" }
+func (c *common) Name() string                    { return engineName }
 
 // TempDir returns a temporary directory for the test to use.
 // The directory is automatically removed by Cleanup when the test and all its
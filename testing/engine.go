@@ -0,0 +1,14 @@
+package testing
+
+// The fuzzing engine driving the fuzzer, as set by Init.
+var (
+	engineName    = "libFuzzer"
+	engineRejects = true // the engine supports rejecting inputs
+)
+
+// Init is called by the generated main from LLVMFuzzerInitialize, once before
+// fuzzing, with the name of the engine and whether it supports rejecting
+// inputs by a return value of -1. Without it, libFuzzer is assumed.
+func Init(engine string, reject bool) {
+	engineName, engineRejects = engine, reject
+}
@@ -8,7 +8,19 @@ import (
 
 type F struct {
 	common
-	s *input.Source
+	s       *input.Source
+	decoder Decoder
+}
+
+// Decoder is a generated, typed decoder for the arguments of a fuzz target.
+// It returns false if ff is not of the type it was generated for.
+type Decoder func(src *input.Source, t *T, ff any) bool
+
+// SetDecoder sets a decoder to use instead of reflection, if it matches the
+// fuzz target. Generated decoders implement the current input layout, inputs
+// with a header for an older layout are decoded by reflection.
+func (f *F) SetDecoder(d Decoder) {
+	f.decoder = d
 }
 
 func NewF(data []byte) *F {
@@ -21,8 +33,20 @@ func NewF(data []byte) *F {
 // NOT implemented
 func (f *F) Add(args ...any) {}
 
+// SetMinLens sets the minimum number of elements of the dynamic-sized arguments
+// (strings and slices) of the fuzz target, in argument order. See
+// input.Source.SetMinLens. It is not part of the standard testing.F, the
+// generated main calls it for the --min-lens flag.
+func (f *F) SetMinLens(lens ...int) {
+	f.s.SetMinLens(lens...)
+}
+
 func (f *F) Fuzz(ff any) {
-	f.s.FillAndCall(ff, reflect.ValueOf(new(T)))
+	t := new(T)
+	if f.decoder != nil && f.s.Version() == input.LayoutVersion && f.decoder(f.s, t, ff) {
+		return
+	}
+	f.s.FillAndCall(ff, reflect.ValueOf(t))
 }
 
 // ReturnValue returns a value for libfuzzer. Docs:
@@ -38,8 +62,15 @@ func (f *F) Fuzz(ff any) {
 //
 // By default: return 1
 // We do this by checking how much data the fuzzer tried to consume.
+// If the input was exhausted and the padding policy is input.PadSkip, the
+// target was never invoked, and -1 is returned to reject the input, if the
+// engine supports it (libFuzzer, Centipede; see Init). The generated main
+// reports all other values as 0.
 func (f *F) ReturnValue() int {
 	if f.s.IsExhausted() {
+		if f.s.PadPolicy() == input.PadSkip && engineRejects {
+			return -1
+		}
 		return 0
 	}
 	// We're a bit lenient, but if the input is >2x the used portion, then return
@@ -0,0 +1,16 @@
+package testing
+
+// M is the type passed to a TestMain function. Test files are compiled into
+// the fuzzer along with the fuzz target, but tests are never run.
+type M struct{}
+
+func (m *M) Run() int { panic("not implemented") }
+
+// Short reports false, as in a normal test run.
+func Short() bool { return false }
+
+// Verbose reports false, as in a normal test run.
+func Verbose() bool { return false }
+
+// Testing reports false, as the fuzzer is not a test binary.
+func Testing() bool { return false }
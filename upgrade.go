@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/holiman/gofuzz-shim/input"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	upgradeCommand = &cli.Command{
+		Name:  "upgrade",
+		Usage: "Upgrade a corpus to the current input layout",
+		Description: fmt.Sprintf(`Upgrade decodes each file in the corpus directory with the layout it was created
+with, and re-encodes it with the current layout (version %d). The upgraded files
+have a header recording the layout version.`, input.LayoutVersion),
+		ArgsUsage: "<corpus-dir>",
+		Flags: []cli.Flag{
+			fuzzFlag,
+			sourceFlag,
+			argTypesFlag,
+			fromFlag,
+			outDirFlag,
+		},
+		Action: upgrade,
+	}
+
+	fromFlag = &cli.IntFlag{
+		Name:  "from",
+		Usage: "The layout version of corpus files without a header. Version 1 is the layout used before headers were introduced",
+		Value: 1,
+	}
+
+	outDirFlag = &cli.PathFlag{
+		Name:  "out",
+		Usage: "Directory to write the upgraded corpus to (default: upgrade in place)",
+	}
+)
+
+func upgrade(ctx *cli.Context) error {
+	fn, err := fuzzFuncFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("expected one corpus directory")
+	}
+	from := ctx.Int(fromFlag.Name)
+	return convertCorpus(ctx.Args().First(), ctx.Path(outDirFlag.Name), func(data []byte) ([]byte, error) {
+		return input.Upgrade(from, fn, data)
+	})
+}
+
+// convertCorpus converts all files in the corpus directory dir, and writes them
+// to outDir (or back into dir, if outDir is empty). Files which cannot be
+// converted are skipped.
+func convertCorpus(dir, outDir string, convert func([]byte) ([]byte, error)) error {
+	if outDir == "" {
+		outDir = dir
+	} else if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var converted, skipped int
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		out, err := convert(data)
+		if err != nil {
+			slog.Warn("Skipping corpus file", "file", entry.Name(), "err", err)
+			skipped++
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(outDir, entry.Name()), out, 0644); err != nil {
+			return err
+		}
+		converted++
+	}
+	slog.Info("Converted corpus", "files", converted, "skipped", skipped, "version", input.LayoutVersion)
+	return nil
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/holiman/gofuzz-shim/input"
+	shimtesting "github.com/holiman/gofuzz-shim/testing"
 )
 
 func copyFile(t *testing.T, src, dst string) error {
@@ -74,7 +83,7 @@ func TestRewrite(t *testing.T) {
 }
 
 func TestGenerateMain(t *testing.T) {
-	f, err := createMain("github.com/ethereum/go-ethereum/common/bitutil", "FuzzEncoder")
+	f, err := createMain(&mainTarget{PkgPath: "github.com/ethereum/go-ethereum/common/bitutil", Func: "FuzzEncoder", Engine: "libfuzzer", Entry: "reject"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -83,3 +92,993 @@ func TestGenerateMain(t *testing.T) {
 	t.Cleanup(func() { os.Remove(f) })
 
 }
+
+func TestFuzzArgs(t *testing.T) {
+	for i, tc := range []struct {
+		fn   string
+		want string
+	}{
+		{"FuzzEncoder", "[]byte"},
+		{"FuzzDecoder", "[]byte"},
+		{"FuzzMissing", ""},
+	} {
+		args, err := fuzzArgs([]string{"./testdata/target/target1_test.go.txt"}, tc.fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := strings.Join(args, ","); have != tc.want {
+			t.Errorf("test %d: have %q want %q", i, have, tc.want)
+		}
+	}
+}
+
+func TestGenerateMainDecoder(t *testing.T) {
+	decoder, err := genDecoder("FuzzEncoder", []string{"uint8", "[]byte", "bool", "string"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := createMain(&mainTarget{PkgPath: "github.com/ethereum/go-ethereum/common/bitutil", Func: "FuzzEncoder", Decoder: decoder, Engine: "libfuzzer", Entry: "reject"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f) })
+	compareFiles(t, f, "./testdata/main.decoder.output.want")
+}
+
+func TestDecoderLayoutVersion(t *testing.T) {
+	for _, tc := range []struct {
+		data    []byte
+		decoder bool
+	}{
+		{[]byte{7}, true},
+		{input.AddHeader([]byte{7}), true},
+		// An input with a header for layout 1 is decoded by reflection
+		{append([]byte("\xffGFS\x01"), 7), false},
+	} {
+		var decoded, called bool
+		f := shimtesting.NewF(tc.data)
+		f.SetDecoder(func(src *input.Source, t *shimtesting.T, ff any) bool {
+			decoded = true
+			return false
+		})
+		f.Fuzz(func(t *shimtesting.T, a uint8) { called = a == 7 })
+		if decoded != tc.decoder || !called {
+			t.Errorf("input %q: decoder used %v, target called %v", tc.data, decoded, called)
+		}
+	}
+}
+
+func TestGenDecoderUnsupported(t *testing.T) {
+	for _, args := range [][]string{
+		{"uint8", "MyType"},
+		{"[]int"},
+		{},
+	} {
+		decoder, err := genDecoder("FuzzX", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoder != "" {
+			t.Errorf("expected no decoder for %v", args)
+		}
+	}
+}
+
+func TestMinLens(t *testing.T) {
+	lens := func(minLens ...int) string {
+		var have string
+		f := shimtesting.NewF([]byte("\xff\x00abcde"))
+		f.SetMinLens(minLens...)
+		f.Fuzz(func(t *shimtesting.T, a string, b []byte) {
+			have = fmt.Sprintf("%d,%d", len(a), len(b))
+		})
+		return have
+	}
+	if have, want := lens(), "5,0"; have != want {
+		t.Errorf("without minimum lengths: have %v want %v", have, want)
+	}
+	if have, want := lens(1, 2), "3,2"; have != want {
+		t.Errorf("with minimum lengths: have %v want %v", have, want)
+	}
+	f, err := createMain(&mainTarget{PkgPath: "github.com/ethereum/go-ethereum/common/bitutil", Func: "FuzzEncoder", Engine: "libfuzzer", Entry: "reject", MinLens: []int{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f) })
+	if data, _ := os.ReadFile(f); !bytes.Contains(data, []byte("\tfuzzer.SetMinLens(1, 2)\n\tdefer fuzzer.Finished()")) {
+		t.Errorf("minimum lengths not set:\n%s", data)
+	}
+}
+
+func TestFuzzFuncOf(t *testing.T) {
+	fn, err := fuzzFuncOf([]string{"uint16", "string", "[]byte"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := input.Explain(fn, []byte("\x00\x01\x01\x01abcd"))
+	want := `input: 8 bytes
+arg 1 (uint16): bytes [0:2] 0x0001 => 1
+weights: bytes [2:4] [1 1] (sum 2, 4 bytes to distribute)
+arg 2 (string): bytes [4:6] 0x6162 (weight 1) => "ab"
+arg 3 ([]uint8): bytes [6:8] 0x6364 (remainder) => "cd"
+`
+	if have != want {
+		t.Fatalf("have\n%v\nwant\n%v", have, want)
+	}
+	if _, err := fuzzFuncOf([]string{"map[string]int"}); err == nil {
+		t.Fatal("expected error for unsupported type")
+	}
+}
+
+func TestExplainCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crash")
+	if err := os.WriteFile(path, []byte("\x00\x00ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	app.Writer = &out
+	defer func() { app.Writer = os.Stdout }()
+	err := app.Run([]string{"gofuzz-shim", "explain", "--args", "string,[]byte", "--min-lens", "3",
+		"--tags", "gofuzz_strings_printable,gofuzz_pad_skip", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := path + `:
+input: 4 bytes
+weights: bytes [0:2] [0 0] (sum 0, 0 bytes to distribute)
+arg 1 (string): bytes [2:4] 0x6162 (weight 0) => "\"# " (ZERO-PADDED: 1 bytes)
+arg 2 ([]uint8): bytes [4:4] 0x (remainder) => ""
+input exhausted: the target would not be invoked
+`
+	if have := out.String(); !strings.HasPrefix(have, want) {
+		t.Errorf("have\n%v\nwant\n%v", have, want)
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	for _, name := range []string{"uint64", "[]uint32", "*big.Int", "netip.AddrPort", "[]bool", "input.PrintableString", "input.UTF8String"} {
+		typ, ok := typeOf(name)
+		if !ok {
+			t.Fatalf("type %v not found", name)
+		}
+		if have := typ.String(); have != name {
+			t.Errorf("have %v want %v", have, name)
+		}
+	}
+	if _, ok := typeOf("[]map[int]int"); ok {
+		t.Fatal("expected unsupported type")
+	}
+}
+
+func TestIsLegacy(t *testing.T) {
+	for i, tc := range []struct {
+		path string
+		fn   string
+		want bool
+	}{
+		{"./testdata/target/legacy.go.txt", "Fuzz", true},
+		{"./testdata/target/legacy.go.txt", "FuzzNoResult", false},
+		{"./testdata/target/legacy.go.txt", "FuzzString", false},
+		{"./testdata/target/legacy.go.txt", "FuzzMissing", false},
+		{"./testdata/target/target1_test.go.txt", "FuzzEncoder", false},
+	} {
+		have, err := isLegacy([]string{tc.path}, tc.fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have != tc.want {
+			t.Errorf("test %d: have %v want %v", i, have, tc.want)
+		}
+	}
+}
+
+func TestGenerateMainLegacy(t *testing.T) {
+	f, err := createMain(&mainTarget{PkgPath: "github.com/ethereum/go-ethereum/common/bitutil", Func: "Fuzz", Legacy: true, Engine: "libfuzzer", Entry: "reject"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f) })
+	compareFiles(t, f, "./testdata/main.legacy.output.want")
+}
+
+func TestInstrumentCalls(t *testing.T) {
+	src, err := os.ReadFile("./testdata/seeds/decode_test.go.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, out, n, err := instrumentCalls("decode_test.go", src, "TestDecode", "Decode", []string{"uint8", "[]byte"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg != "decode" || n != 2 {
+		t.Fatalf("have package %q, %d calls, want \"decode\", 2 calls", pkg, n)
+	}
+	for _, want := range []string{
+		"Decode(gofuzzshimRecord(2, 0, tc.kind), gofuzzshimRecord(2, 1, tc.data))",
+		"Decode(gofuzzshimRecord[uint8](2, 0, 3), gofuzzshimRecord[[]byte](2, 1, nil))",
+		"\t\tDecode(kind, data)\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestSeeds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go test")
+	}
+	dir, err := os.MkdirTemp("./testdata", "seeds-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	testSeeds(t, dir)
+}
+
+func TestSeedsExternalModule(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go test")
+	}
+	// A module which does not require the shim
+	dir := t.TempDir()
+	gomod := "module example.com/decode\n\ngo 1.21\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOWORK", "off")
+	testSeeds(t, dir)
+	if data, _ := os.ReadFile(filepath.Join(dir, "go.mod")); string(data) != gomod {
+		t.Errorf("go.mod modified:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go.sum")); !os.IsNotExist(err) {
+		t.Errorf("go.sum created: %v", err)
+	}
+}
+
+// testSeeds records the seeds of testdata/seeds, copied into dir.
+func testSeeds(t *testing.T, dir string) {
+	for _, name := range []string{"decode.go", "decode_test.go"} {
+		if err := copyFile(t, filepath.Join("./testdata/seeds", name+".txt"), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testFile := filepath.Join(dir, "decode_test.go")
+	out := filepath.Join(dir, "out")
+	err := app.Run([]string{"gofuzz-shim", "seeds", "--func", "FuzzDecode", "--source", testFile,
+		"--test", "TestDecode", "--call", "Decode", "--out", out, testFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, _ := fuzzFuncOf([]string{"uint8", "[]byte"})
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have []string
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(out, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vals, err := input.Decode(fn, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have = append(have, fmt.Sprintf("%d %q", vals[0].Uint(), vals[1].Bytes()))
+	}
+	slices.Sort(have)
+	if want := []string{`1 "foo"`, `2 "barbaz"`, `3 ""`, `4 "qux"`, `5 "quux"`}; !slices.Equal(have, want) {
+		t.Errorf("have %q, want %q", have, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, seedsHelper)); !os.IsNotExist(err) {
+		t.Errorf("helper not removed: %v", err)
+	}
+	if data, _ := os.ReadFile(testFile); !strings.Contains(string(data), "\t\t\tDecode(tc.kind, tc.data)") {
+		t.Errorf("test file not restored")
+	}
+}
+
+func TestLinkOutputs(t *testing.T) {
+	for _, tc := range []struct{ output, archive, exe string }{
+		{"fuzzer.a", "fuzzer.a", "fuzzer"},
+		{"out/fuzz_rlp", "out/fuzz_rlp.a", "out/fuzz_rlp"},
+		{".a", ".a.a", ".a"},
+	} {
+		archive, exe := linkOutputs(tc.output)
+		if archive != tc.archive || exe != tc.exe {
+			t.Errorf("%q: have %q, %q want %q, %q", tc.output, archive, exe, tc.archive, tc.exe)
+		}
+	}
+}
+
+func TestLinker(t *testing.T) {
+	libfuzzer := engines["libfuzzer"]
+	if _, err := newLinker("no-such-clang++", libfuzzer, nil, nil); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not-found error, have %v", err)
+	}
+	l, err := newLinker("go", libfuzzer, []string{"address", "undefined"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := l.command("fuzzer.a", "fuzzer")
+	if have, want := strings.Join(cmd.Args[1:], " "), "-fsanitize=fuzzer,address,undefined fuzzer.a -lpthread -o fuzzer"; have != want {
+		t.Errorf("have %q want %q", have, want)
+	}
+	if _, err := newLinker("go", libfuzzer, []string{"address,undefined"}, nil); err == nil {
+		t.Error("expected error for invalid sanitizer")
+	}
+}
+
+func TestSetupAFL(t *testing.T) {
+	cfg := &buildConfig{
+		pkg:      "./testdata/ossfuzz",
+		files:    []string{"testdata/ossfuzz/parse_test.go"},
+		fuzzFunc: "FuzzParse",
+		exe:      filepath.Join(t.TempDir(), "fuzzer"),
+		engine:   engines["aflpp"],
+	}
+	if err := setupAFL(cfg); err != nil {
+		t.Fatal(err)
+	}
+	in := filepath.Join(aflDir(cfg.exe), "in")
+	entries, err := os.ReadDir(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The f.Add seeds and the go corpus
+	fn, _ := fuzzFuncOf([]string{"uint8", "string"})
+	var decoded []string
+	for _, entry := range entries {
+		data, _ := os.ReadFile(filepath.Join(in, entry.Name()))
+		if _, _, ok := input.ParseHeader(data); !ok {
+			t.Errorf("seed %v has no header", entry.Name())
+		}
+		vals, err := input.Decode(fn, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, fmt.Sprintf("%d %q", vals[0].Uint(), vals[1].String()))
+	}
+	slices.Sort(decoded)
+	if have, want := strings.Join(decoded, ","), `1 "magic",2 "",5 "corpus"`; have != want {
+		t.Errorf("have seeds %v, want %v", have, want)
+	}
+	if tokens, _ := os.ReadDir(filepath.Join(aflDir(cfg.exe), "dict")); len(tokens) == 0 {
+		t.Error("no dictionary tokens written")
+	}
+	// Existing seeds are kept, and the target's seeds are not duplicated.
+	os.WriteFile(filepath.Join(in, "a"), []byte("a"), 0644)
+	if err := setupAFL(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if seeds, _ := os.ReadDir(in); len(seeds) != len(entries)+1 {
+		t.Fatalf("have %d seeds, want %d", len(seeds), len(entries)+1)
+	}
+}
+
+func TestSetupAFLDefaults(t *testing.T) {
+	// Not a native fuzz target, so there are no seeds
+	cfg := &buildConfig{
+		pkg:      "./testdata/dict",
+		fuzzFunc: "FuzzNone",
+		exe:      filepath.Join(t.TempDir(), "fuzzer"),
+		engine:   engines["aflpp"],
+	}
+	dir := filepath.Join(aflDir(cfg.exe), "dict")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A token left by an earlier build, with more tokens
+	if err := os.WriteFile(filepath.Join(dir, "token9999"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setupAFL(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if seeds, _ := os.ReadDir(filepath.Join(aflDir(cfg.exe), "in")); len(seeds) != 1 || seeds[0].Name() != "seed" {
+		t.Errorf("unexpected seeds %v", seeds)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 10 {
+		t.Errorf("have %d tokens, want 10", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "token9999")); !os.IsNotExist(err) {
+		t.Errorf("stale token not removed: %v", err)
+	}
+}
+
+func TestGenerateMainEngine(t *testing.T) {
+	f, err := createMain(&mainTarget{PkgPath: "github.com/ethereum/go-ethereum/common/bitutil", Func: "FuzzEncoder", Engine: "honggfuzz", Entry: "ignore", Init: "FuzzInit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f) })
+	compareFiles(t, f, "./testdata/main.honggfuzz.output.want")
+}
+
+func TestLinkerEngines(t *testing.T) {
+	for _, tc := range []struct {
+		engine string
+		libs   []string
+		want   string
+	}{
+		{"aflpp", nil, "-fsanitize=fuzzer,address fuzzer.a -lpthread -o fuzzer"},
+		{"honggfuzz", nil, "-fsanitize=address fuzzer.a -lpthread -o fuzzer"},
+		{"centipede", []string{"libcentipede_runner.a"},
+			"-fsanitize=address fuzzer.a -Wl,--whole-archive libcentipede_runner.a -Wl,--no-whole-archive -ldl -lrt -lpthread -o fuzzer"},
+	} {
+		l, err := newLinker("go", engines[tc.engine], []string{"address"}, tc.libs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := strings.Join(l.command("fuzzer.a", "fuzzer").Args[1:], " "); have != tc.want {
+			t.Errorf("%v: have %q want %q", tc.engine, have, tc.want)
+		}
+	}
+	if _, err := newLinker("go", engines["centipede"], nil, nil); err == nil {
+		t.Error("expected error for missing centipede runtime")
+	}
+	if _, err := engineByName("nosuchfuzzer"); err == nil {
+		t.Error("expected error for unknown engine")
+	}
+}
+
+func TestLinkCC(t *testing.T) {
+	t.Setenv("CXX", "clang++-18")
+	for _, tc := range []struct {
+		flag, engine, want string
+	}{
+		{"", "libfuzzer", "clang++-18"},
+		{"", "centipede", "clang++-18"},
+		{"", "aflpp", "afl-clang-fast++"},
+		{"", "honggfuzz", "hfuzz-clang++"},
+		{"my-afl++", "aflpp", "my-afl++"},
+	} {
+		if have := linkCC(tc.flag, engines[tc.engine]); have != tc.want {
+			t.Errorf("%v %q: have %v want %v", tc.engine, tc.flag, have, tc.want)
+		}
+	}
+	t.Setenv("CXX", "")
+	if have := linkCC("", engines["libfuzzer"]); have != "clang++" {
+		t.Errorf("have %v want clang++", have)
+	}
+}
+
+func TestParseGoCorpus(t *testing.T) {
+	data := "go test fuzz v1\n[]byte(\"a\\x00\")\nstring(\"b\")\nint(-5)\nint8(-128)\nuint16(65535)\nbyte('x')\nrune('é')\n" +
+		"float64(1.5)\nfloat32(-0.1)\nmath.Float64frombits(0x7ff8000000000001)\nbool(true)\nuint64(18446744073709551615)\n"
+	vals, err := parseGoCorpus([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := fmt.Sprintf("%#v", vals)
+	want := `[]interface {}{[]uint8{0x61, 0x0}, "b", -5, -128, 0xffff, 0x78, 233, 1.5, -0.1, NaN, true, 0xffffffffffffffff}`
+	if have != want {
+		t.Errorf("have\n%v\nwant\n%v", have, want)
+	}
+	for _, bad := range []string{
+		"int(1)\n",
+		"go test fuzz v1\nint8(128)\n",
+		"go test fuzz v1\nuint(-1)\n",
+		"go test fuzz v1\nfoo(1)\n",
+		"go test fuzz v1\nint(x)\n",
+	} {
+		if _, err := parseGoCorpus([]byte(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestOSSFuzzTargets(t *testing.T) {
+	pkgs, err := listPackages([]string{"./testdata/ossfuzz"}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || pkgs[0].ImportPath != "github.com/holiman/gofuzz-shim/testdata/ossfuzz" {
+		t.Fatalf("unexpected packages %v", pkgs)
+	}
+	targets, err := fuzzTargets(pkgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, target := range targets {
+		names = append(names, target.name)
+	}
+	if have, want := strings.Join(names, ","), "FuzzParse,FuzzNothing,FuzzParseExternal"; have != want {
+		t.Fatalf("have targets %v, want %v", have, want)
+	}
+	seeds, err := targets[0].seeds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := fmt.Sprint(seeds), "[[1 magic] [2 ] [5 corpus]]"; have != want {
+		t.Errorf("have seeds %v, want %v", have, want)
+	}
+	dir := t.TempDir()
+	// The seeds decode in the string mode of the build tags
+	for _, tags := range [][]string{nil, {"gofuzz_strings_printable"}} {
+		zipPath := filepath.Join(dir, "FuzzParse_seed_corpus.zip")
+		if err := writeSeedCorpus(targets[0], zipPath, tags); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.OpenReader(zipPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded []string
+		for _, f := range zr.File {
+			r, _ := f.Open()
+			data, _ := io.ReadAll(r)
+			src := input.NewSource(data)
+			src.SetStringMode(stringModeForTags(tags))
+			src.FillAndCall(func(t *testing.T, kind uint8, s string) {
+				decoded = append(decoded, fmt.Sprintf("%d %q", kind, s))
+			}, reflect.ValueOf(new(testing.T)))
+		}
+		zr.Close()
+		slices.Sort(decoded)
+		if have, want := strings.Join(decoded, ","), `1 "magic",2 "",5 "corpus"`; have != want {
+			t.Errorf("tags %v: have %v, want %v", tags, have, want)
+		}
+	}
+	if err := writeTargetDict(targets[0], filepath.Join(dir, "FuzzParse.dict"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "FuzzParse.dict")); string(data) != "\"magic\"\n\"\\x05\\xde\"\n\"\\xde\\x05\"\n" {
+		t.Errorf("unexpected dictionary %q", data)
+	}
+	if err := writeOptions(filepath.Join(dir, "FuzzParse.options"), []string{"max_len=4096", "timeout = 10"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "FuzzParse.options")); string(data) != "[libfuzzer]\nmax_len = 4096\ntimeout = 10\n" {
+		t.Errorf("unexpected options %q", data)
+	}
+}
+
+func TestOSSFuzzLinker(t *testing.T) {
+	t.Setenv("CXX", "go")
+	t.Setenv("CXXFLAGS", "-O1 -fsanitize=address")
+	t.Setenv("LIB_FUZZING_ENGINE", "-fsanitize=fuzzer")
+	t.Setenv("CFLAGS", "-O1 -fsanitize=address,fuzzer-no-link")
+	l, err := ossfuzzLinker(engines["libfuzzer"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := strings.Join(l.command("/tmp/FuzzA.a", "/out/FuzzA").Args[1:], " "),
+		"-O1 -fsanitize=address -fsanitize=fuzzer /tmp/FuzzA.a -o /out/FuzzA"; have != want {
+		t.Errorf("have %q want %q", have, want)
+	}
+	if have, want := strings.Join(ossfuzzEnv(), " "), "CGO_CFLAGS=-O1 -fsanitize=address,fuzzer-no-link CGO_CXXFLAGS=-O1 -fsanitize=address"; have != want {
+		t.Errorf("have %q want %q", have, want)
+	}
+}
+
+func TestExtractTokens(t *testing.T) {
+	tokens, err := packageTokens("./testdata/dict", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := formatDict(tokens)
+	want := `"\x01\x02\x03\x04"
+"\x04\x03\x02\x01"
+"%PDF-"
+"<script>"
+"GET"
+"POST"
+"magic\"quote"
+"\x89PNG"
+"\xbe\xba\xfe\xca"
+"\xca\xfe\xba\xbe"
+`
+	if have != want {
+		t.Errorf("have\n%v\nwant\n%v", have, want)
+	}
+}
+
+func TestWriteDictAfterBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go build")
+	}
+	// No files given, the build finds the file declaring the target
+	dir := t.TempDir()
+	cfg := &buildConfig{
+		pkg:       "./testdata/ossfuzz",
+		fuzzFunc:  "FuzzParse",
+		output:    filepath.Join(dir, "fuzzer.a"),
+		buildArgs: []string{"-gcflags=all="},
+		tags:      []string{"gofuzz_strings_printable"},
+		engine:    engines["libfuzzer"],
+	}
+	if err := buildFuzzer(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDict(cfg, filepath.Join(dir, "fuzzer.dict")); err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := input.EncodeString("magic", input.StringPrintable)
+	data, _ := os.ReadFile(filepath.Join(dir, "fuzzer.dict"))
+	if !strings.Contains(string(data), formatDict([]string{string(enc)})) {
+		t.Errorf("dictionary lacks the printable encoding of \"magic\":\n%s", data)
+	}
+}
+
+func TestEncodeTokens(t *testing.T) {
+	tokens := []string{"GET", "\x89PNG"}
+	if have := encodeTokens(tokens, []string{"[]byte", "string"}, nil); !slices.Equal(have, tokens) {
+		t.Errorf("raw: have %q", have)
+	}
+	if have, want := encodeTokens(tokens, []string{"input.PrintableString"}, nil), []string{"'%4"}; !slices.Equal(have, want) {
+		t.Errorf("printable: have %q want %q", have, want)
+	}
+	if have, want := encodeTokens(tokens, []string{"uint8", "string"}, []string{"gofuzz_strings_printable"}), []string{"GET", "'%4", "\x89PNG"}; !slices.Equal(have, want) {
+		t.Errorf("printable tag: have %q want %q", have, want)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	config := `# Defaults
+out = "build"
+tags = ['gofuzz_libfuzzer', "libfuzzer"] # trailing comment
+link = true
+
+[[target]]
+name = "fuzz_rlp"
+package = "github.com/ethereum/go-ethereum/rlp"
+func = "FuzzDecode"
+fiximports = [
+	"rlp/decode_test.go", # the target
+	"rlp/encode_test.go",
+]
+dict = true
+
+[[target]]
+name = "fuzz_bitutil"
+package = "github.com/ethereum/go-ethereum/common/bitutil"
+engine = "aflpp"
+link = false
+build_args = ["-ldflags=-X main.tag=#1"]
+
+[[target]]
+name = "fuzz_trie"
+package = """
+github.com/ethereum/go-ethereum/trie"""
+init = "FuzzInit"
+min_lens = [4, 1]
+`
+	targets, err := loadConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*targetConfig{
+		{
+			Name: "fuzz_rlp", Package: "github.com/ethereum/go-ethereum/rlp", Func: "FuzzDecode",
+			FixImports: []string{"rlp/decode_test.go", "rlp/encode_test.go"}, Out: "build",
+			Tags: []string{"gofuzz_libfuzzer", "libfuzzer"}, Engine: "libfuzzer", Link: true, Dict: true,
+		},
+		{
+			Name: "fuzz_bitutil", Package: "github.com/ethereum/go-ethereum/common/bitutil", Func: "Fuzz",
+			Out: "build", Tags: []string{"gofuzz_libfuzzer", "libfuzzer"}, Engine: "aflpp",
+			BuildArgs: []string{"-ldflags=-X main.tag=#1"},
+		},
+		{
+			Name: "fuzz_trie", Package: "github.com/ethereum/go-ethereum/trie", Func: "Fuzz",
+			Init: "FuzzInit", MinLens: []int{4, 1}, Out: "build", Tags: []string{"gofuzz_libfuzzer", "libfuzzer"},
+			Engine: "libfuzzer", Link: true,
+		},
+	}
+	if len(targets) != len(want) {
+		t.Fatalf("have %d targets, want %d", len(targets), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(targets[i], want[i]) {
+			t.Errorf("target %d: have\n%+v\nwant\n%+v", i, targets[i], want[i])
+		}
+	}
+	for _, bad := range []string{
+		"[target]\n",
+		"[[target]]\nname = \"a\"\n",
+		"[[target]]\nname = \"a\"\npackage = \"b\"\n[[target]]\nname = \"a\"\npackage = \"c\"\n",
+		"nosuchkey = true\n",
+		"link = \"yes\"\n",
+		"tags = [\"a\", \n",
+		"out = \"unterminated\n",
+		"tags = [\"a\" \"b\"]\n",
+		"[[target]]\nname = \"a\"\npackage = \"b\"\nmin_lens = [\"x\"]\n",
+		"[[target]]\nname = \"a\"\npackage = \"b\"\nnosuchkey = 1\n",
+	} {
+		if _, err := loadConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestResolvePackage(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, fn, want string
+	}{
+		{"github.com/holiman/gofuzz-shim/testdata/ossfuzz", "FuzzParse", "github.com/holiman/gofuzz-shim/testdata/ossfuzz"},
+		{"./testdata/ossfuzz", "FuzzParse", "github.com/holiman/gofuzz-shim/testdata/ossfuzz"},
+		{"testdata/ossfuzz", "FuzzParse", "github.com/holiman/gofuzz-shim/testdata/ossfuzz"},
+		{"./testdata/ossfuzz/", "FuzzParse", "github.com/holiman/gofuzz-shim/testdata/ossfuzz"},
+		{"./...", "DecodeGo118", "github.com/holiman/gofuzz-shim/input"},
+		{"./...", "TestLoadConfig", "github.com/holiman/gofuzz-shim"},
+	} {
+		have, err := resolvePackage(tc.pattern, tc.fn, nil)
+		if err != nil {
+			t.Errorf("%v: %v", tc.pattern, err)
+			continue
+		}
+		if have.ImportPath != tc.want {
+			t.Errorf("%v: have %v want %v", tc.pattern, have.ImportPath, tc.want)
+		}
+	}
+	abs, _ := filepath.Abs("./testdata/ossfuzz")
+	if have, err := resolvePackage(abs, "FuzzParse", nil); err != nil || have.ImportPath != "github.com/holiman/gofuzz-shim/testdata/ossfuzz" {
+		t.Errorf("absolute path: have %v, %v", have, err)
+	}
+	for _, tc := range []struct{ pattern, fn string }{
+		{"./...", "FuzzNoSuchTarget"},
+		{"./nosuchdir", "FuzzParse"},
+	} {
+		if _, err := resolvePackage(tc.pattern, tc.fn, nil); err == nil {
+			t.Errorf("%v: expected error", tc.pattern)
+		}
+	}
+}
+
+func TestBuildExternalTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go build")
+	}
+	// Build without instrumentation, which needs the libFuzzer runtime
+	cfg := &buildConfig{
+		pkg:       "./testdata/ossfuzz",
+		fuzzFunc:  "FuzzParseExternal",
+		output:    filepath.Join(t.TempDir(), "fuzzer.a"),
+		buildArgs: []string{"-gcflags=all="},
+		engine:    engines["libfuzzer"],
+	}
+	if err := buildFuzzer(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cfg.output); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join("testdata", "ossfuzz", xtestPkg)); !os.IsNotExist(err) {
+		t.Errorf("%v not removed: %v", xtestPkg, err)
+	}
+	if _, err := os.Stat(filepath.Join("testdata", "ossfuzz", "parse_ext_test.go")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKeepSources(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go build")
+	}
+	dir := t.TempDir()
+	cfg := &buildConfig{
+		pkg:         "./testdata/ossfuzz",
+		fuzzFunc:    "FuzzParseExternal",
+		output:      filepath.Join(dir, "fuzzer.a"),
+		buildArgs:   []string{"-gcflags=all="},
+		engine:      engines["libfuzzer"],
+		dryRun:      true,
+		keepSources: filepath.Join(dir, "src"),
+	}
+	if err := buildFuzzer(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cfg.output); !os.IsNotExist(err) {
+		t.Fatalf("dry run built %v: %v", cfg.output, err)
+	}
+	for _, name := range []string{"overlay.json", "build.sh", "mod/go.mod", xtestPkg + "/parse_ext_test.go_fuzz.go"} {
+		if _, err := os.Stat(filepath.Join(cfg.keepSources, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if mains, _ := filepath.Glob(filepath.Join(cfg.keepSources, "main.*.go")); len(mains) != 1 {
+		t.Errorf("have main files %v", mains)
+	}
+	// The kept sources suffice to repeat the build
+	cmd := exec.Command("sh", filepath.Join(cfg.keepSources, "build.sh"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if _, err := os.Stat(cfg.output); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDryRunKeepsSources(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go list")
+	}
+	dir := t.TempDir()
+	cfg := &buildConfig{
+		pkg:      "./testdata/ossfuzz",
+		fuzzFunc: "FuzzParse",
+		output:   filepath.Join(dir, "fuzzer.a"),
+		engine:   engines["libfuzzer"],
+		dryRun:   true,
+	}
+	if err := buildFuzzer(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.keepSources == "" {
+		t.Fatal("dry run kept no sources")
+	}
+	defer os.RemoveAll(cfg.keepSources)
+	if _, err := os.Stat(filepath.Join(cfg.keepSources, "build.sh")); err != nil {
+		t.Error(err)
+	}
+	// The build command keeps the sources of each target in a subdirectory
+	target := &targetConfig{
+		Name:      "fuzz_parse",
+		Package:   "./testdata/ossfuzz",
+		Func:      "FuzzParse",
+		Out:       filepath.Join(dir, "out"),
+		Engine:    "aflpp",
+		Dict:      true,
+		BuildArgs: []string{"-gcflags=all="},
+	}
+	if err := buildTarget(target, true, filepath.Join(dir, "src", target.Name)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "src", target.Name, "build.sh")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(target.Out); !os.IsNotExist(err) {
+		t.Errorf("dry run created the output directory: %v", err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, tc := range []struct{ s, want string }{
+		{"-gcflags", "-gcflags"},
+		{"all=-d=libfuzzer", "all=-d=libfuzzer"},
+		{"", "''"},
+		{"-ldflags=-s -w", "'-ldflags=-s -w'"},
+		{"it's", `'it'\''s'`},
+	} {
+		if have := shellQuote(tc.s); have != tc.want {
+			t.Errorf("%q: have %v want %v", tc.s, have, tc.want)
+		}
+	}
+}
+
+func TestShimOverlay(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go build")
+	}
+	shim, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  fmt.Sprintf("module example.com/target\n\ngo 1.21\n\nreplace %v => %v\n", shimModule, shim),
+		"go.sum":  "",
+		"main.go": fmt.Sprintf("package main\n\nimport _ %q\n\nfunc main() {}\n", shimModule+"/testing"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOWORK", "off")
+	flags, env, cleanup, err := shimOverlay(dir, shimRequirement{version: "v0.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if len(flags) != 2 || !strings.HasPrefix(flags[0], "-modfile=") || len(env) != 0 {
+		t.Fatalf("unexpected flags %v, env %v", flags, env)
+	}
+	if err := goCommand(dir, env, append(append([]string{"build", "-o", os.DevNull}, flags...), ".")...); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != content {
+			t.Errorf("%v modified:\n%s", name, data)
+		}
+	}
+}
+
+func TestShimOverlayWorkspace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go build")
+	}
+	shim := shimSource()
+	if shim == "" {
+		t.Fatal("shim source not found")
+	}
+	for _, tc := range []struct {
+		name    string
+		replace string // replacement of the shim in go.work
+		req     shimRequirement
+	}{
+		{"source", "", shimRequirement{dir: shim}},
+		// An unpublished version, but the workspace replaces the shim
+		{"replaced", fmt.Sprintf("\nreplace %v => %v\n", shimModule, shim), shimRequirement{version: "v9.9.9"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{
+				"go.work":        "go 1.21\n\nuse ./target\n\nreplace example.com/lib => ./lib\n" + tc.replace,
+				"target/go.mod":  "module example.com/target\n\ngo 1.21\n\nrequire example.com/lib v0.0.0-00010101000000-000000000000\n",
+				"target/go.sum":  "",
+				"target/main.go": fmt.Sprintf("package main\n\nimport (\n\t_ \"example.com/lib\"\n\t_ %q\n)\n\nfunc main() {}\n", shimModule+"/testing"),
+				"lib/go.mod":     "module example.com/lib\n\ngo 1.21\n",
+				"lib/lib.go":     "package lib\n",
+			}
+			for name, content := range files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("GOFLAGS", "")
+			t.Setenv("GOPROXY", "off")
+			t.Setenv("GOWORK", "")
+			target := filepath.Join(dir, "target")
+			flags, env, cleanup, err := shimOverlay(target, tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+			if len(flags) != 0 || len(env) != 1 || !strings.HasPrefix(env[0], "GOWORK=") {
+				t.Fatalf("unexpected flags %v, env %v", flags, env)
+			}
+			if err := goCommand(target, env, "build", "-o", os.DevNull, "."); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range files {
+				if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != content {
+					t.Errorf("%v modified:\n%s", name, data)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dir, "go.work.sum")); !os.IsNotExist(err) {
+				t.Errorf("go.work.sum created: %v", err)
+			}
+		})
+	}
+}
+
+func TestShimOverlayVendor(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":             "module example.com/target\n\ngo 1.21\n",
+		"vendor/modules.txt": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+	if _, _, _, err := shimOverlay(dir, shimRequirement{version: "v0.0.0"}); err == nil || !strings.Contains(err.Error(), "not vendored") {
+		t.Fatalf("expected error for vendor mode, have %v", err)
+	}
+	// Vendor mode is off with -mod=mod
+	t.Setenv("GOFLAGS", "-mod=mod")
+	if _, _, cleanup, err := shimOverlay(dir, shimRequirement{version: "v0.0.0"}); err != nil {
+		t.Fatal(err)
+	} else {
+		cleanup()
+	}
+}